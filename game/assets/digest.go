@@ -0,0 +1,158 @@
+package assets
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+
+	"github.com/jakubDoka/goml/goss"
+	"github.com/jakubDoka/mlok/ggl"
+)
+
+// Field is name and printed value of definition field
+type Field struct {
+	Name, Value string
+}
+
+// Definition is one compiled stat in comparable form
+type Definition struct {
+	Kind, Name string
+	Fields     []Field
+}
+
+// Key returns kind and name of definition
+func (d *Definition) Key() string {
+	return d.Kind + " " + d.Name
+}
+
+// Fields lists fields of definition, sprites are skipped as they only
+// change looks and differ with textures
+func Fields(def interface{}) (res []Field) {
+	fields("", reflect.ValueOf(def), &res)
+	return
+}
+
+func fields(prefix string, v reflect.Value, res *[]Field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + t.Field(i).Name
+		switch f := v.Field(i).Interface().(type) {
+		case ggl.Sprite:
+		case Bullet:
+			fields(name+".", reflect.ValueOf(f), res)
+		case []Obstacle:
+			for j := range f {
+				fields(fmt.Sprintf("%s[%d].", name, j), reflect.ValueOf(f[j]), res)
+			}
+		case []Turret:
+			for j := range f {
+				fields(fmt.Sprintf("%s[%d].", name, j), reflect.ValueOf(f[j]), res)
+			}
+		default:
+			// maps are printed with sorted keys
+			*res = append(*res, Field{name, fmt.Sprint(f)})
+		}
+	}
+}
+
+// Definitions returns all stats in comparable form, order is the same as
+// order of indexes
+func (s *Stats) Definitions() (res []Definition) {
+	for _, b := range s.Bullets.Slice() {
+		res = append(res, Definition{"bullet", b.K, Fields(b.V)})
+	}
+	for _, t := range s.Tanks.Slice() {
+		res = append(res, Definition{"tank", t.K, Fields(t.V)})
+	}
+	for _, w := range s.Worlds.Slice() {
+		res = append(res, Definition{"world", w.K, Fields(w.V)})
+	}
+	return
+}
+
+// Hash returns hash of all stats, two games with equal hash agree on
+// what each index means
+func (s *Stats) Hash() uint64 {
+	h := fnv.New64a()
+	for _, d := range s.Definitions() {
+		fmt.Fprintln(h, d.Key())
+		for _, f := range d.Fields {
+			fmt.Fprintln(h, f.Name, f.Value)
+		}
+	}
+	return h.Sum64()
+}
+
+// DiffStats lists differences between local and remote stats in readable form
+func DiffStats(local, remote *Stats) (res []string) {
+	rd := remote.Definitions()
+	remotes := make(map[string]*Definition, len(rd))
+	for i := range rd {
+		remotes[rd[i].Key()] = &rd[i]
+	}
+
+	for _, l := range local.Definitions() {
+		r, ok := remotes[l.Key()]
+		if !ok {
+			res = append(res, l.Key()+": missing on server")
+			continue
+		}
+		delete(remotes, l.Key())
+
+		// turrets and obstacles make amount of fields differ
+		values := make(map[string]string, len(r.Fields))
+		for _, f := range r.Fields {
+			values[f.Name] = f.Value
+		}
+		for _, f := range l.Fields {
+			v, ok := values[f.Name]
+			if !ok {
+				res = append(res, fmt.Sprintf("%s: %s is %s here, missing on server", l.Key(), f.Name, f.Value))
+				continue
+			}
+			delete(values, f.Name)
+			if v != f.Value {
+				res = append(res, fmt.Sprintf("%s: %s is %s here, %s on server", l.Key(), f.Name, f.Value, v))
+			}
+		}
+		for _, f := range r.Fields {
+			if _, ok := values[f.Name]; ok {
+				res = append(res, fmt.Sprintf("%s: %s is missing here, %s on server", l.Key(), f.Name, f.Value))
+			}
+		}
+	}
+
+	for _, r := range rd {
+		if _, ok := remotes[r.Key()]; ok {
+			res = append(res, r.Key()+": missing here")
+		}
+	}
+
+	return
+}
+
+// StatsFrom compiles stats from stat sources of other game, current stats
+// stay untouched
+func (a *Assets) StatsFrom(sources map[string][]File) (s Stats, err error) {
+	var raw RawStats
+	rv := reflect.ValueOf(&raw).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		dest := goss.Styles{}
+		for _, f := range sources[rv.Type().Field(i).Name] {
+			style, err := a.UIParser.GS.Parse(f.Data)
+			if err != nil {
+				return s, ErrProblem.Args("goss", f.Path).Wrap(err)
+			}
+			dest.Add(style)
+		}
+		rv.Field(i).Set(reflect.ValueOf(dest))
+	}
+
+	stats, rawStats := a.Stats, a.RawStats
+	a.Stats, a.RawStats = NStats(), raw
+	a.CompileStats()
+	s = a.Stats
+	a.Stats, a.RawStats = stats, rawStats
+
+	return
+}
@@ -0,0 +1,46 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+)
+
+func compiled() *Assets {
+	a := NAssets()
+	a.Load("assets", RawAssets)
+	a.Compile()
+	return a
+}
+
+func TestDiffStatsTurretCount(t *testing.T) {
+	local, remote := compiled(), compiled()
+	if d := DiffStats(&local.Stats, &remote.Stats); len(d) != 0 {
+		t.Fatalf("equal stats differ: %v", d)
+	}
+
+	tanks := remote.Stats.Tanks.Slice()
+	tank := &tanks[0].V
+	tank.Turrets = append(tank.Turrets, tank.Turrets[0])
+	tank.Speed++
+
+	// both directions, longer list of fields used to be indexed out of range
+	for _, c := range []struct {
+		local, remote *Stats
+		missing       string
+	}{
+		{&local.Stats, &remote.Stats, "is missing here"},
+		{&remote.Stats, &local.Stats, "missing on server"},
+	} {
+		var speed, turret bool
+		for _, l := range DiffStats(c.local, c.remote) {
+			speed = speed || strings.Contains(l, ": Speed is ")
+			turret = turret || strings.Contains(l, "Turrets[") && strings.Contains(l, c.missing)
+		}
+		if !speed || !turret {
+			t.Fatalf("differences are not reported: %v", DiffStats(c.local, c.remote))
+		}
+	}
+	if local.Stats.Hash() == remote.Stats.Hash() {
+		t.Fatal("hash ignores added turret")
+	}
+}
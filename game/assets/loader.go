@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
 	_ "image/png"
@@ -43,6 +44,8 @@ type Assets struct {
 	GameConfig
 
 	RawStats RawStats
+	// StatSources are loaded stat files by RawStats field they belong to
+	StatSources map[string][]File
 
 	Loader, AppData load.Util
 	Root            string
@@ -123,7 +126,16 @@ func (a *Assets) CompileStats() {
 
 		put := svf.Addr().MethodByName("Put")
 		proc := av.MethodByName(stf.Name[:len(stf.Name)-1])
-		for k, v := range rvf.Interface().(goss.Styles) {
+		// sorted so indexes are same on every machine with same mods
+		styles := rvf.Interface().(goss.Styles)
+		keys := make([]string, 0, len(styles))
+		for k := range styles {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v := styles[k]
 			name := reflect.ValueOf(k)
 			put.Call([]reflect.Value{
 				name,
@@ -162,12 +174,19 @@ func (a *Assets) Bullet(name string, stl RawStyle) Bullet {
 		LiveTime: stl.Float("livetime", 1),
 		Damage:   stl.Int("damage", 1),
 		Sprite:   a.Sprite(stl.Ident("sprite", name+"3")),
+
+		Count:         stl.Int("count", 1),
+		Spread:        stl.Float("spread", 0),
+		Burst:         stl.Int("burst", 1),
+		BurstDelay:    stl.Float("burst_delay", .1),
+		SpeedVariance: stl.Float("speed_variance", 0),
 	}
 }
 
 func (a *Assets) Tank(name string, stl RawStyle) Tank {
 	return Tank{
-		Bullet: a.Bullet(name, stl.Sub("bullet", a.RawStats.Bullets)),
+		Name:    name,
+		Turrets: a.Turrets(name, stl),
 
 		Speed:        stl.Float("speed", 2000),
 		Transmission: stl.Float("transmission", .5),
@@ -176,6 +195,8 @@ func (a *Assets) Tank(name string, stl RawStyle) Tank {
 
 		MaxHealth:         stl.Int("max_health", 50),
 		Size:              stl.Float("size", 20),
+		Mass:              stl.Float("mass", 1),
+		RamDamage:         stl.Float("ram_damage", 0),
 		RetreatRatio:      stl.Int("retreat_ratio", 5),
 		RegenerationProc:  stl.Float("regeneration_proc", 10),
 		RegenerationTick:  stl.Float("regeneration_tick", 1),
@@ -185,25 +206,21 @@ func (a *Assets) Tank(name string, stl RawStyle) Tank {
 		NeededScore: stl.Int("needed_score", 10),
 		Value:       stl.Int("value", 1),
 
-		Distancing:   stl.Float("distancing", .5),
-		ReloadSpeed:  stl.Float("reload_speed", 1),
-		TurretLen:    stl.Float("turret_len", 50),
-		TurretSpeed:  stl.Float("turret_speed", 3),
-		TurretSprite: a.Sprite(stl.Ident("turret_sprite", name+"1")),
-		TurretPivot:  stl.Vec("turret_pivot", mat.V(-7, 0)),
-		TurretOffset: stl.Vec("turret_offset", mat.V(-7, 0)),
-		Memory:       stl.Float("memory", .5),
+		Distancing: stl.Float("distancing", .5),
+		Memory:     stl.Float("memory", .5),
 	}
 }
 
 func (a *Assets) World(name string, stl RawStyle) World {
 	return World{
+		Name:           name,
 		Size:           stl.Vec("size", mat.V(5000, 5000)),
 		Tile:           stl.Vec("tile_size", mat.V(250, 250)),
 		Scale:          stl.Vec("scale", mat.V(1.5, 1.5)),
 		Friction:       stl.Float("friction", 10),
 		SpawnRate:      stl.Float("spawn_rate", 60),
 		SpawnScaling:   stl.Float("spawn_scaling", .6),
+		Seed:           int64(stl.Int("seed", 0)),
 		TeamCount:      stl.Int("team_count", 2),
 		Background:     stl.RGBA("background_color", rgba.Black),
 		Spawns:         stl.IdentList("spawns"),
@@ -212,6 +229,8 @@ func (a *Assets) World(name string, stl RawStyle) World {
 		LoseMessage:    stl.Sentence("lose_message", "YOU LOST"),
 		DisabledEnemy:  stl.IdentSet("disabled_enemy"),
 		DisabledPlayer: stl.IdentSet("disabled_player"),
+		Obstacles:      a.WorldObstacles(name, stl),
+		Tiles:          a.NavTiles(name, stl),
 	}
 }
 
@@ -251,7 +270,11 @@ func (a *Assets) LoadStyles(styles ...string) {
 		vf := v.Field(i)
 		tf := t.Field(i)
 		style := goss.Styles{}
-		a.LoadStyle(a.Path("stats", strings.ToLower(tf.Name)), true, style)
+		files := a.LoadStyle(a.Path("stats", strings.ToLower(tf.Name)), true, style)
+		if a.StatSources == nil {
+			a.StatSources = map[string][]File{}
+		}
+		a.StatSources[tf.Name] = append(a.StatSources[tf.Name], files...)
 		if vf.IsZero() {
 			vf.Set(reflect.ValueOf(style))
 		} else {
@@ -364,7 +387,8 @@ func (a *Assets) AddErr(err error) {
 	}
 }
 
-func (a *Assets) LoadStyle(p string, rec bool, dest goss.Styles) {
+// LoadStyle parses all goss files in p into dest and returns the parsed files
+func (a *Assets) LoadStyle(p string, rec bool, dest goss.Styles) (files []File) {
 	list := a.ListPath(p, rec, "goss")
 	for _, p := range list {
 		bts, err := a.Loader.ReadFile(p)
@@ -380,7 +404,10 @@ func (a *Assets) LoadStyle(p string, rec bool, dest goss.Styles) {
 		}
 
 		dest.Add(style)
+		files = append(files, File{p, bts})
 	}
+
+	return
 }
 
 func PathName(p string) string {
@@ -420,6 +447,7 @@ type Config struct {
 }
 
 type World struct {
+	Name                              string
 	Scale, Size, Tile                 mat.Vec
 	Friction, SpawnRate, SpawnScaling float64
 	Seed                              int64
@@ -428,29 +456,42 @@ type World struct {
 	Player, WinMessage, LoseMessage   string
 	Spawns                            []string
 	DisabledEnemy, DisabledPlayer     map[string]bool
+	Obstacles                         []Obstacle
+	Tiles                             []NavTile
 }
 
 type Tank struct {
-	Bullet Bullet
+	Name string
 
 	Speed, Transmission, Steer, RegenerationProc, RegenerationTick float64
 	BaseSprite                                                     ggl.Sprite
 
-	Size                                       float64
+	Size, Mass, RamDamage                      float64
 	MaxHealth, RetreatRatio, RegenerationPower int
 
 	Next               string
 	NeededScore, Value int
 
-	TurretLen, ReloadSpeed, TurretSpeed, Memory, Distancing float64
-	TurretPivot, TurretOffset                               mat.Vec
-	TurretSprite                                            ggl.Sprite
+	Memory, Distancing float64
+	Turrets            []Turret
 }
 
 type Bullet struct {
 	Speed, Size, LiveTime float64
 	Damage                int
 	Sprite                ggl.Sprite
+
+	// Count is amount of bullets fired at once, they are spread evenly over
+	// Spread radians, single bullet deviates randomly in it instead
+	Count  int
+	Spread float64
+	// Burst is amount of volleys fired per reload, BurstDelay is time between
+	// them
+	Burst      int
+	BurstDelay float64
+	// SpeedVariance is how much speed of each bullet randomly differs, as
+	// portion of Speed
+	SpeedVariance float64
 }
 
 func (b *Bullet) Range() float64 {
@@ -542,4 +583,16 @@ type GameConfig struct {
 	Mods                []string
 	UIColor, Background mat.RGBA
 	ScrollSensitivity   float64
+
+	// NetLatency and NetJitter are in milliseconds, NetLoss is fraction of lost
+	// messages, they make client connection simulate bad network
+	NetLatency, NetJitter int
+	NetLoss               float64
+
+	// SyncStats makes client use stats of server it connects to when they
+	// differ from its own
+	SyncStats bool
+
+	// Transport is what hosted server uses, tcp or udp, tcp if empty
+	Transport string
 }
@@ -0,0 +1,68 @@
+package assets
+
+import (
+	"math"
+
+	"github.com/jakubDoka/goml/goss"
+	"github.com/jakubDoka/mlok/load"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/sterr"
+)
+
+var (
+	ErrNavTile = sterr.New("tiles %d of world %s needs at: x y x y...; and cost that is number not smaller then 1 or 'blocked'")
+)
+
+// NavTile sets cost of driving trough tiles of world navigation grid, tile
+// coordinates are in tile_size units, Cost multiplies length of path trough
+// tile
+//
+// goss: tiles: {at: 3 4 3 5; cost: 4;} {at: 10 10; cost: blocked;};
+type NavTile struct {
+	At      []mat.Point
+	Cost    float64
+	Blocked bool
+}
+
+// NavTiles parses tile flags of world, invalid ones are reported and skipped
+func (a *Assets) NavTiles(world string, stl RawStyle) (res []NavTile) {
+	for i, v := range stl.Style["tiles"] {
+		s, ok := v.(goss.Style)
+		if !ok {
+			a.Log(ErrNavTile.Args(i, world))
+			continue
+		}
+
+		t, ok := ParseNavTile(NStyle(s))
+		if !ok {
+			a.Log(ErrNavTile.Args(i, world))
+			continue
+		}
+		res = append(res, t)
+	}
+
+	return
+}
+
+// ParseNavTile reads one tiles entry
+func ParseNavTile(stl RawStyle) (t NavTile, ok bool) {
+	var buff [256]float64
+	n := load.CollectFloats(stl.Style["at"], buff[:])
+	if n == 0 || n%2 != 0 {
+		return
+	}
+	for i := 0; i < n; i += 2 {
+		t.At = append(t.At, mat.P(int(buff[i]), int(buff[i+1])))
+	}
+
+	if stl.Ident("cost", "") == "blocked" {
+		t.Blocked = true
+		return t, true
+	}
+	t.Cost = stl.Float("cost", 1)
+	if t.Cost < 1 || math.IsInf(t.Cost, 0) || math.IsNaN(t.Cost) {
+		return
+	}
+
+	return t, true
+}
@@ -0,0 +1,147 @@
+package assets
+
+import (
+	"github.com/jakubDoka/goml/goss"
+	"github.com/jakubDoka/mlok/ggl"
+	"github.com/jakubDoka/mlok/load"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/sterr"
+)
+
+var (
+	ErrObstacle = sterr.New("obstacle %d of world %s needs one of: rect: x0 y0 x1 y1; circle: x y radius; polygon: x y x y x y...;")
+)
+
+// Shape is kind of obstacle geometry
+type Shape uint8
+
+// obstacle shapes
+const (
+	Rect Shape = iota
+	Circle
+	Polygon
+)
+
+// Obstacle is static wall or rock of world, tanks cannot drive trough it and
+// bullets stop on it
+//
+// goss: obstacles: { rect: 0 0 100 20; sprite: obstacles1; } { circle: 300 300 40; };
+type Obstacle struct {
+	Shape Shape
+	// Bounds is the rectangle of Rect and bounding box of other shapes, sprite
+	// is stretched over it
+	Bounds mat.AABB
+	Center mat.Vec
+	Radius float64
+	// Points are vertices of Rect or convex Polygon in counter clockwise order
+	Points []mat.Vec
+	Sprite ggl.Sprite
+}
+
+// WorldObstacles parses obstacles of world, invalid ones are reported and skipped
+func (a *Assets) WorldObstacles(world string, stl RawStyle) (res []Obstacle) {
+	for i, v := range stl.Style["obstacles"] {
+		s, ok := v.(goss.Style)
+		if !ok {
+			a.Log(ErrObstacle.Args(i, world))
+			continue
+		}
+
+		r := NStyle(s)
+		o, ok := ParseObstacle(r)
+		if !ok {
+			a.Log(ErrObstacle.Args(i, world))
+			continue
+		}
+
+		def := "obstacles2"
+		if o.Shape == Rect {
+			def = "obstacles1"
+		}
+		o.Sprite = a.Sprite(r.Ident("sprite", def))
+		res = append(res, o)
+	}
+
+	return
+}
+
+// ParseObstacle reads geometry of one obstacle
+func ParseObstacle(stl RawStyle) (o Obstacle, ok bool) {
+	var buff [256]float64
+	switch {
+	case stl.Style["rect"] != nil:
+		if load.CollectFloats(stl.Style["rect"], buff[:4]) != 4 {
+			return
+		}
+		o.Shape = Rect
+		o.Bounds = point(mat.V(buff[0], buff[1])).Union(point(mat.V(buff[2], buff[3])))
+		o.Center = o.Bounds.Center()
+		if o.Bounds.W() == 0 || o.Bounds.H() == 0 {
+			return
+		}
+		min, max := o.Bounds.Min, o.Bounds.Max
+		o.Points = []mat.Vec{min, mat.V(max.X, min.Y), max, mat.V(min.X, max.Y)}
+	case stl.Style["circle"] != nil:
+		if load.CollectFloats(stl.Style["circle"], buff[:3]) != 3 || buff[2] <= 0 {
+			return
+		}
+		o.Shape = Circle
+		o.Center, o.Radius = mat.V(buff[0], buff[1]), buff[2]
+		o.Bounds = mat.Square(o.Center, o.Radius)
+	case stl.Style["polygon"] != nil:
+		n := load.CollectFloats(stl.Style["polygon"], buff[:])
+		if n < 6 || n%2 != 0 {
+			return
+		}
+		o.Shape = Polygon
+		for i := 0; i < n; i += 2 {
+			o.Points = append(o.Points, mat.V(buff[i], buff[i+1]))
+		}
+		if !Convex(o.Points) {
+			return
+		}
+
+		o.Bounds = point(o.Points[0])
+		for _, p := range o.Points {
+			o.Bounds = o.Bounds.Union(point(p))
+			o.Center.AddE(p)
+		}
+		o.Center = o.Center.Scaled(1 / float64(len(o.Points)))
+	default:
+		return
+	}
+
+	return o, true
+}
+
+func point(p mat.Vec) mat.AABB {
+	return mat.AABB{Min: p, Max: p}
+}
+
+// Convex returns whether polygon is convex and puts its points to counter
+// clockwise order
+func Convex(points []mat.Vec) bool {
+	var sign float64
+	for i := range points {
+		a, b, c := points[i], points[(i+1)%len(points)], points[(i+2)%len(points)]
+		cross := a.To(b).Cross(b.To(c))
+		if cross == 0 {
+			continue
+		}
+		if sign != 0 && (cross > 0) != (sign > 0) {
+			return false
+		}
+		sign = cross
+	}
+
+	if sign == 0 {
+		return false
+	}
+	if sign < 0 {
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+
+	return true
+}
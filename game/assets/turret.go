@@ -0,0 +1,99 @@
+package assets
+
+import (
+	"github.com/jakubDoka/goml/goss"
+	"github.com/jakubDoka/mlok/ggl"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/sterr"
+)
+
+var (
+	ErrTurret = sterr.New("turret %d of tank %s is not a style")
+)
+
+// Turret is gun of tank, each turret rotates, reloads and shoots on its own
+//
+// goss: turrets: {turret_offset: 10 8; bullet: bullet2;} {turret_offset: 10 -8; turret_rot: 3.14; turret_arc: 1.5;};
+type Turret struct {
+	Bullet Bullet
+
+	Len, ReloadSpeed, TurnSpeed float64
+	// Rot is rotation relative to base turret rests in, Arc is how far it
+	// can turn from Rot to each side, zero means turret turns all around
+	Rot, Arc      float64
+	Pivot, Offset mat.Vec
+	Sprite        ggl.Sprite
+}
+
+// Turrets parses turrets of tank, tank without turrets list has one turret
+// made of its own turret properties, they are also defaults of listed turrets
+func (a *Assets) Turrets(name string, stl RawStyle) (res []Turret) {
+	def := a.Turret(name, stl, Turret{
+		Bullet:      a.Bullet(name, stl.Sub("bullet", a.RawStats.Bullets)),
+		Len:         50,
+		ReloadSpeed: 1,
+		TurnSpeed:   3,
+		Pivot:       mat.V(-7, 0),
+		Offset:      mat.V(-7, 0),
+		Sprite:      a.Sprite(name + "1"),
+	})
+
+	for i, v := range stl.Style["turrets"] {
+		s, ok := v.(goss.Style)
+		if !ok {
+			a.Log(ErrTurret.Args(i, name))
+			continue
+		}
+		res = append(res, a.Turret(name, NStyle(s), def))
+	}
+
+	if len(res) == 0 {
+		res = append(res, def)
+	}
+
+	return
+}
+
+// Turret reads turret properties, missing ones are taken from def
+func (a *Assets) Turret(name string, stl RawStyle, def Turret) Turret {
+	t := Turret{
+		Bullet:      def.Bullet,
+		Len:         stl.Float("turret_len", def.Len),
+		ReloadSpeed: stl.Float("reload_speed", def.ReloadSpeed),
+		TurnSpeed:   stl.Float("turret_speed", def.TurnSpeed),
+		Rot:         stl.Float("turret_rot", def.Rot),
+		Arc:         stl.Float("turret_arc", def.Arc),
+		Pivot:       stl.Vec("turret_pivot", def.Pivot),
+		Offset:      stl.Vec("turret_offset", def.Offset),
+		Sprite:      def.Sprite,
+	}
+
+	if s, ok := stl.Style.Ident("turret_sprite"); ok {
+		t.Sprite = a.Sprite(s)
+	}
+	if stl.Style["bullet"] != nil {
+		t.Bullet = a.Bullet(name, stl.Sub("bullet", a.RawStats.Bullets))
+	}
+
+	return t
+}
+
+// Spread returns the widest spread of tank turrets
+func (t *Tank) Spread() (s float64) {
+	for i := range t.Turrets {
+		if bs := t.Turrets[i].Bullet.Spread; bs > s {
+			s = bs
+		}
+	}
+	return
+}
+
+// Range returns the longest range of tank turrets
+func (t *Tank) Range() (r float64) {
+	for i := range t.Turrets {
+		if br := t.Turrets[i].Bullet.Range(); br > r {
+			r = br
+		}
+	}
+	return
+}
@@ -0,0 +1,252 @@
+package game
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jakubDoka/mlok/ggl"
+	"github.com/jakubDoka/mlok/ggl/key"
+	"github.com/jakubDoka/mlok/ggl/ui"
+)
+
+// chat properties
+const (
+	// ChatRate is how many messages per second client can send in long run,
+	// ChatBurst is how many it can send at once
+	ChatRate  = .5
+	ChatBurst = 5
+	// ChatLines is amount of messages chat overlay shows
+	ChatLines = 8
+)
+
+// ChatBox is chat overlay of match hud and lobby, Enter opens it and sends
+// the message, Escape closes it and Tab switches between all and team
+// channel, text starting with '/' is console command
+type ChatBox struct {
+	Log        []ChatMessage
+	Open, Team bool
+	// Selected is true when input was clicked, area then handles typing
+	// itself, Fresh is true in frame chat was opened
+	Selected, Fresh bool
+	// Scene is name of scene overlay was last drawn to
+	Scene string
+	Dirty bool
+}
+
+// Add appends message to the log
+func (c *ChatBox) Add(m ChatMessage) {
+	if len(c.Log) == ChatLines {
+		c.Log = append(c.Log[:0], c.Log[1:]...)
+	}
+	c.Log = append(c.Log, m)
+	c.Dirty = true
+}
+
+// Reset forgets messages of ended session, overlay is hidden by next update
+func (c *ChatBox) Reset() {
+	c.Log = nil
+	c.Open, c.Team = false, false
+	c.Dirty = true
+}
+
+// Text returns the log as displayed
+func (c *ChatBox) Text() string {
+	var sb strings.Builder
+	for i, m := range c.Log {
+		if i != 0 {
+			sb.WriteByte('\n')
+		}
+		if m.Team {
+			sb.WriteString("(team) ")
+		}
+		sb.WriteString(m.From)
+		sb.WriteString(": ")
+		sb.WriteString(m.Text)
+	}
+	return sb.String()
+}
+
+// CleanChat removes control characters and surrounding spaces and cuts text
+// to MaxChat
+func CleanChat(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	for len(text) > MaxChat {
+		_, s := utf8.DecodeLastRuneInString(text)
+		text = text[:len(text)-s]
+	}
+	return strings.TrimSpace(text)
+}
+
+// Chatting returns whether chat is available, that is in lobby and
+// multiplayer match
+func (w *World) Chatting() bool {
+	switch w.GameState {
+	case InLobby, MultiplayerServer, MultiplayerClient:
+		return !w.Headless && (w.Server != nil || w.Client != nil)
+	}
+	return false
+}
+
+// ChatScene returns name of scene chat overlay is in
+func (w *World) ChatScene() string {
+	if w.GameState == InLobby {
+		return "lobby"
+	}
+	return "singleplayer"
+}
+
+// UpdateChat handles chat keys and refreshes the overlay, it has to run
+// before player reads its controls
+func (w *World) UpdateChat(win *ggl.Window) {
+	c := &w.Chat
+	if !w.Chatting() {
+		if c.Scene != "" {
+			w.UIScenes[c.Scene].ID("chat").SetHidden(true)
+			c.Scene = ""
+		}
+		c.Open = false
+		return
+	}
+
+	name := w.ChatScene()
+	scene := w.UIScenes[name]
+	input := scene.ID("chat_input").Module.(*ui.Area)
+	if name != c.Scene {
+		if c.Scene != "" {
+			w.UIScenes[c.Scene].ID("chat").SetHidden(true)
+		}
+		scene.ID("chat").SetHidden(false)
+		c.Scene = name
+		c.Dirty = true
+	}
+
+	if !c.Open {
+		if win.JustPressed(key.Enter) {
+			c.Open = true
+			c.Fresh = true
+			c.Dirty = true
+			input.SetText("")
+		}
+	} else {
+		text := string(input.Content)
+		if c.Fresh {
+			// selected area also typed the Enter that opened chat
+			text = strings.TrimPrefix(text, "\n")
+			c.Fresh = false
+		}
+		if !c.Selected {
+			if win.JustPressed(key.Backspace) && text != "" {
+				_, s := utf8.DecodeLastRuneInString(text)
+				text = text[:len(text)-s]
+			}
+			text += win.Typed()
+			if win.JustPressed(key.Enter) {
+				text += "\n"
+			}
+		}
+		text = strings.Replace(text, "\t", "", -1)
+
+		switch {
+		case win.JustPressed(key.Escape):
+			c.Open = false
+			c.Dirty = true
+		case win.JustPressed(key.Tab):
+			c.Team = !c.Team
+			c.Dirty = true
+		case strings.Contains(text, "\n"):
+			w.SendChat(text[:strings.Index(text, "\n")], c.Team)
+			c.Open = false
+			c.Dirty = true
+			text = ""
+		}
+
+		if len(text) > MaxChat {
+			text = CleanChat(text)
+		}
+		if text != string(input.Content) {
+			input.SetText(text)
+		}
+	}
+
+	if !c.Dirty {
+		return
+	}
+	c.Dirty = false
+
+	scene.ID("chat_line").SetHidden(!c.Open)
+	channel := "all:"
+	if c.Team {
+		channel = "team:"
+	}
+	scene.ID("chat_channel").Module.(*ui.Text).SetText(channel)
+	scene.ID("chat_log").Module.(*ui.Text).SetText(c.Text())
+}
+
+// SendChat sends message to all players or to team, text starting with '/'
+// is console command, host runs it right away
+func (w *World) SendChat(text string, team bool) {
+	text = CleanChat(text)
+	if text == "" {
+		return
+	}
+
+	if text[0] == '/' {
+		if w.Client != nil {
+			w.SendCommand(text[1:])
+		} else if out := strings.TrimSuffix(w.Execute(text[1:]), "\n"); out != "" {
+			w.Chat.Add(ChatMessage{From: "server", Text: out})
+		}
+		return
+	}
+
+	m := ChatMessage{Text: text, Team: team}
+	if w.Client != nil {
+		b := w.Client.Message(Chat)
+		m.Write(b)
+		w.Client.Send(b)
+	} else if w.Server != nil {
+		m.From = "host"
+		if p := w.Server.Lobby.Player(0); p != nil {
+			m.From = p.Name
+		}
+		w.Server.Chats = append(w.Server.Chats, m)
+	}
+}
+
+// AllowChat spends one message of client chat allowance, allowance refills
+// with ChatRate up to ChatBurst
+func (ss *Session) AllowChat(now time.Time) bool {
+	if ss.ChatTime.IsZero() {
+		ss.ChatTokens = ChatBurst
+	} else {
+		ss.ChatTokens += now.Sub(ss.ChatTime).Seconds() * ChatRate
+		if ss.ChatTokens > ChatBurst {
+			ss.ChatTokens = ChatBurst
+		}
+	}
+	ss.ChatTime = now
+
+	if ss.ChatTokens < 1 {
+		return false
+	}
+	ss.ChatTokens--
+	return true
+}
+
+// Hears returns whether client receives the message, team messages reach
+// only players of the same team
+func (s *Server) Hears(client int, m *ChatMessage) bool {
+	if !m.Team {
+		return true
+	}
+	sp, rp := s.Lobby.Player(m.Sender), s.Lobby.Player(client)
+	return sp != nil && rp != nil && sp.Team == rp.Team
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCleanChat(t *testing.T) {
+	long := strings.Repeat("a", MaxChat-1) + "é" // é takes two bytes
+	cases := []struct {
+		desc, in, out string
+	}{
+		{"plain", "hello", "hello"},
+		{"spaces", "  hello \t", "hello"},
+		{"control", "he\x00ll\no\x1b", "hello"},
+		{"invalid utf8", "he\xffllo", "hello"},
+		{"fits", strings.Repeat("a", MaxChat), strings.Repeat("a", MaxChat)},
+		{"too long", strings.Repeat("a", MaxChat+10), strings.Repeat("a", MaxChat)},
+		{"split rune", long, strings.Repeat("a", MaxChat-1)},
+		{"multibyte", strings.Repeat("ř", MaxChat), strings.Repeat("ř", MaxChat/2)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			r := CleanChat(c.in)
+			if r != c.out {
+				t.Errorf("CleanChat(%q) = %q, expected %q", c.in, r, c.out)
+			}
+			if len(r) > MaxChat || !utf8.ValidString(r) {
+				t.Errorf("CleanChat(%q) = %q is too long or not valid", c.in, r)
+			}
+		})
+	}
+}
+
+func TestAllowChat(t *testing.T) {
+	ss := &Session{}
+	now := time.Unix(1000, 0)
+	for i := 0; i < ChatBurst; i++ {
+		if !ss.AllowChat(now) {
+			t.Fatalf("message %d of burst was dropped", i)
+		}
+	}
+	if ss.AllowChat(now) {
+		t.Fatal("message over burst was allowed")
+	}
+
+	// one token refills in 1/ChatRate seconds
+	refill := time.Duration(float64(time.Second) / ChatRate)
+	now = now.Add(refill / 2)
+	if ss.AllowChat(now) {
+		t.Fatal("message was allowed before token refilled")
+	}
+	now = now.Add(refill / 2)
+	if !ss.AllowChat(now) {
+		t.Fatal("message was dropped after token refilled")
+	}
+	if ss.AllowChat(now) {
+		t.Fatal("one refilled token allowed two messages")
+	}
+
+	// long silence refills only up to burst
+	now = now.Add(refill * ChatBurst * 10)
+	for i := 0; i < ChatBurst; i++ {
+		if !ss.AllowChat(now) {
+			t.Fatalf("message %d of burst after silence was dropped", i)
+		}
+	}
+	if ss.AllowChat(now) {
+		t.Fatal("silence refilled more than burst")
+	}
+}
+
+func TestHears(t *testing.T) {
+	s := &Server{Lobby: &Lobby{Players: []LobbyPlayer{
+		{ID: 1, Team: 0},
+		{ID: 2, Team: 0},
+		{ID: 3, Team: 1},
+	}}}
+
+	cases := []struct {
+		desc             string
+		sender, receiver int
+		team, hears      bool
+	}{
+		{"all to teammate", 1, 2, false, true},
+		{"all to enemy", 1, 3, false, true},
+		{"all to self", 1, 1, false, true},
+		{"team to teammate", 1, 2, true, true},
+		{"team to self", 1, 1, true, true},
+		{"team to enemy", 1, 3, true, false},
+		{"team from enemy", 3, 1, true, false},
+		{"team to unknown", 1, 4, true, false},
+		{"team from unknown", 4, 1, true, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			m := &ChatMessage{Text: "hi", Team: c.team, Sender: c.sender}
+			if s.Hears(c.receiver, m) != c.hears {
+				t.Errorf("client %d hears message of %d: %v, expected %v", c.receiver, c.sender, !c.hears, c.hears)
+			}
+		})
+	}
+}
@@ -0,0 +1,528 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubDoka/mlok/ggl"
+	"github.com/jakubDoka/mlok/ggl/ui"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/sterr"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+const (
+	// ConnectTimeout is how long client waits for server to accept and answer Hello
+	ConnectTimeout = 5 * time.Second
+	// MaxPending is maximal amount of inputs waiting for acknowledgement
+	MaxPending = TickRate * 2
+	// MaxDiff is maximal amount of stat differences displayed
+	MaxDiff = 8
+)
+
+var (
+	ErrNetTimeout = sterr.New("server did not respond in time")
+)
+
+// Client is connection to multiplayer server, client does not simulate, it
+// only sends inputs and displays snapshots
+type Client struct {
+	*Net
+	ID int
+	// Seq is sequence of last sent input, Acked is tick of last received snapshot
+	Seq, Acked int
+	History    []*WorldState
+	// Pending are sent inputs server did not apply yet, they are replayed on top
+	// of each snapshot
+	Pending []InputMessage
+
+	// Tracks are recent samples of entities, remote ones are displayed Clock
+	// ticks into the match which trails Latest snapshot
+	Tracks, BulletTracks map[int]*Track
+	Clock                float64
+	Latest               int
+
+	Kills []Kill
+	// Lobby is the last lobby state server sent, nil until it arrives
+	Lobby *Lobby
+}
+
+// Connect connects to server on address, if address has no port DefaultPort is
+// used, 'udp://' prefix selects udp transport, client waits in lobby until server
+// starts the match
+func (w *World) Connect(address, name string) error {
+	t, addr, err := SplitScheme(address)
+	if err != nil {
+		return err
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(DefaultPort))
+	}
+
+	conn, err := t.Dial(addr, ConnectTimeout)
+	if err != nil {
+		return err
+	}
+
+	if w.NetLatency != 0 || w.NetJitter != 0 || w.NetLoss != 0 {
+		conn = NLagConn(conn, &Lag{
+			Latency: time.Duration(w.NetLatency) * time.Millisecond,
+			Jitter:  time.Duration(w.NetJitter) * time.Millisecond,
+			Loss:    w.NetLoss,
+		})
+	}
+
+	n := NNet(conn)
+	b := n.Message(Hello)
+	b.PutUint16(NetVersion)
+	b.PutString(name)
+	b.PutUint64(w.Stats.Hash())
+	n.Send(b)
+
+	var welcome netw.Buffer
+	select {
+	case bf, ok := <-n.Inbox:
+		if !ok {
+			return n.Err()
+		}
+		welcome = bf
+	case <-time.After(ConnectTimeout):
+		n.Close()
+		return ErrNetTimeout
+	}
+
+	switch m := Message(welcome.Uint16()); m {
+	case Welcome:
+	case Reject:
+		v := welcome.Uint16()
+		reason := welcome.String()
+		n.Close()
+		if v != NetVersion {
+			return ErrNetVersion.Args(v, NetVersion)
+		}
+		return ErrNetRejected.Args(reason)
+	case Mismatch:
+		n.Close()
+		sources := readSources(&welcome)
+		if welcome.Failed {
+			return ErrNetCorrupt
+		}
+		remote, err := w.Assets.StatsFrom(sources)
+		if err != nil {
+			return err
+		}
+
+		if w.SyncStats && w.LocalStats == nil {
+			w.UseStats(remote)
+			err = w.Connect(address, name)
+			if err != nil {
+				w.RestoreStats()
+			}
+			return err
+		}
+
+		return ErrNetStats.Args(DiffText(assets.DiffStats(&w.Stats, &remote)))
+	default:
+		n.Close()
+		return ErrNetMessage.Args(m)
+	}
+
+	v := welcome.Uint16()
+	id := int(welcome.Uint32())
+	rate := int(welcome.Uint16())
+	if welcome.Failed || rate == 0 {
+		n.Close()
+		return ErrNetCorrupt
+	}
+	if v != NetVersion {
+		n.Close()
+		return ErrNetVersion.Args(v, NetVersion)
+	}
+
+	w.Client = &Client{
+		Net:   n,
+		ID:    id,
+		Acked: -1,
+	}
+	// prediction has to step the same way server does
+	w.Step = 1 / float64(rate)
+	w.GameState = InLobby
+	w.StopDiscovery()
+
+	if !w.Headless {
+		w.SetScene("lobby")
+		w.UpdateLobbyUI()
+	}
+
+	return nil
+}
+
+// UpdateClient applies received messages, reads local controls and sends them
+// to server once per tick
+func (w *World) UpdateClient(win *ggl.Window, delta float64) {
+	c := w.Client
+	w.Delta = delta
+
+	err := w.Sync()
+	if err != nil {
+		w.Leave(err)
+		return
+	}
+
+	for _, id := range w.Tanks.Occupied() {
+		w.Tanks.Item(id).Animate(delta)
+	}
+	w.Interpolate(delta)
+
+	w.UpdatePlayer(win)
+
+	w.Accumulated += math.Min(delta, .1)
+	for w.Accumulated >= w.Step {
+		w.Accumulated -= w.Step
+
+		c.Seq++
+		in := InputMessage{Seq: c.Seq, Acked: c.Acked, View: c.Acked}
+		if c.Tracks != nil {
+			in.View = int(math.Round(c.Clock))
+		}
+		in.Eye = w.CamPos.Inv()
+		in.Sight = win.Frame().Size().Scaled(.5 / w.Zoom)
+		if w.Player != -1 {
+			p := w.Tanks.Item(w.Player)
+			in.Input, in.Aim = p.Input.Clone(), p.Aim
+			w.Predict(p, &in)
+		} else {
+			in.Input = Bindings
+		}
+
+		if len(c.Pending) == MaxPending {
+			c.Pending = append(c.Pending[:0], c.Pending[1:]...)
+		}
+		c.Pending = append(c.Pending, in)
+
+		b := c.Message(InputFrame)
+		in.Write(b)
+		c.Send(b)
+	}
+}
+
+// Sync processes all messages client received since last frame
+func (w *World) Sync() (err error) {
+	defer func() {
+		// binding.S panics on length mismatch
+		if rec := recover(); rec != nil {
+			err = ErrNetCorrupt.Wrap(fmt.Errorf("%v", rec))
+		}
+	}()
+
+	c := w.Client
+	for {
+		select {
+		case b, ok := <-c.Inbox:
+			if !ok {
+				return c.Err()
+			}
+			err = w.HandleServer(&b)
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// HandleServer processes one message from server
+func (w *World) HandleServer(b *netw.Buffer) error {
+	c := w.Client
+	tanks := w.Assets.Tanks.Slice()
+	worlds := w.Assets.Worlds.Slice()
+
+	switch m := Message(b.Uint16()); m {
+	case Snapshot:
+		tick := int(b.Uint32())
+		seq := int(b.Uint32())
+		baseTick := int(b.Int32())
+
+		var base *WorldState
+		if baseTick != -1 {
+			base = c.Base(baseTick)
+			if base == nil {
+				// base is gone, server will send full snapshot
+				c.Acked = -1
+				return nil
+			}
+		}
+
+		s, err := w.ReadDelta(b, base, tick)
+		if err != nil {
+			return err
+		}
+
+		if len(c.History) == StateHistory {
+			c.History = append(c.History[:0], c.History[1:]...)
+		}
+		c.History = append(c.History, s)
+		c.Acked = tick
+
+		w.ApplyState(s)
+		w.Track(s)
+		w.Reconcile(seq)
+	case SpawnEvent:
+		// tank itself comes with next snapshot
+		var s SpawnMessage
+		s.Read(b)
+	case DeathEvent:
+		var d DeathMessage
+		d.Read(b)
+		k := Kill{Tick: w.Ticks, Killer: "?", Victim: "?"}
+		if d.KillerTank >= 0 && d.KillerTank < len(tanks) {
+			k.Killer = tanks[d.KillerTank].K
+		}
+		if d.VictimTank >= 0 && d.VictimTank < len(tanks) {
+			k.Victim = tanks[d.VictimTank].K
+		}
+		c.Kills = append(c.Kills, k)
+	case Chat:
+		var ch ChatMessage
+		ch.Read(b)
+		w.Chat.Add(ch)
+	case LobbyState:
+		l := &Lobby{}
+		l.Read(b)
+		if b.Failed {
+			return ErrNetCorrupt
+		}
+		if l.World >= len(worlds) {
+			return ErrNetAsset.Args(l.World)
+		}
+		c.Lobby = l
+		w.UpdateLobbyUI()
+	case Start:
+		idx := int(b.Uint16())
+		seed := b.Int64()
+		if b.Failed {
+			return ErrNetCorrupt
+		}
+		if idx >= len(worlds) {
+			return ErrNetAsset.Args(idx)
+		}
+		// server can restart the match, ticks start from zero again
+		c.History, c.Pending, c.Tracks, c.BulletTracks = nil, nil, nil, nil
+		c.Acked = -1
+		w.LoadMapSeed(MultiplayerClient, &worlds[idx].V, seed)
+	case Command:
+		w.Chat.Add(ChatMessage{From: "server", Text: b.String()})
+	case Reject:
+		b.Uint16()
+		return ErrNetRejected.Args(b.String())
+	default:
+		return ErrNetMessage.Args(m)
+	}
+
+	if b.Failed {
+		return ErrNetCorrupt
+	}
+
+	return nil
+}
+
+// SendCommand sends console command to server, output comes back as chat
+// message from server
+func (w *World) SendCommand(line string) {
+	b := w.Client.Message(Command)
+	b.PutString(line)
+	w.Client.Send(b)
+}
+
+// Base returns received snapshot with given tick or nil
+func (c *Client) Base(tick int) *WorldState {
+	for _, st := range c.History {
+		if st.Tick == tick {
+			return st
+		}
+	}
+	return nil
+}
+
+// ApplyState makes world entities match the state, tanks that persist keep
+// their effects and get hit or heal effect when health changes
+func (w *World) ApplyState(s *WorldState) {
+	tanks := w.Assets.Tanks.Slice()
+	w.Ticks = s.Tick
+
+	// tanks are reinserted into Hasher so prediction collides with them
+	old := w.Tanks.Occupied()
+	for _, id := range old {
+		t := w.Tanks.Item(id)
+		w.Hasher.Remove(t.Address, t.ID, t.Group)
+	}
+
+	i := 0
+	for _, ts := range s.Tanks {
+		for i < len(old) && old[i] < ts.ID {
+			w.Tanks.Remove(old[i])
+			i++
+		}
+
+		asset := &tanks[ts.Tank].V
+		var t *Tank
+		if i < len(old) && old[i] == ts.ID {
+			i++
+			t = w.Tanks.Item(ts.ID)
+			if t.Tank != asset {
+				t.Init(asset)
+			} else if ts.Health < t.Health {
+				t.HitInter.Reset()
+				t.BarInter.Reset()
+			} else if ts.Health > t.Health {
+				t.HealInter.Reset()
+			}
+		} else {
+			t = w.Tanks.Place(ts.ID)
+			t.Init(asset)
+		}
+
+		t.ID = ts.ID
+		t.Pos = ts.Pos
+		t.Vel = ts.Vel
+		t.Aim = ts.Aim
+		t.BaseRot = ts.BaseRot
+		for i := range t.Guns {
+			if i < len(ts.TurretRot) && i < len(ts.Reload) {
+				t.Guns[i].Rot = ts.TurretRot[i]
+				t.Guns[i].Reloader.Progress = ts.Reload[i]
+			}
+		}
+		t.Health = ts.Health
+		t.Score = ts.Score
+		t.Group = ts.Group
+		t.Client = ts.Client
+		t.Player = ts.Player
+		w.Hasher.Insert(&t.Address, t.Pos, t.ID, t.Group)
+	}
+	for ; i < len(old); i++ {
+		w.Tanks.Remove(old[i])
+	}
+
+	w.Bullets.Clear()
+	for _, bs := range s.Bullets {
+		b := w.Bullets.Place(bs.ID)
+		b.Bullet = w.BulletAt(bs.Bullet)
+		b.Sprite = b.Bullet.Sprite
+		b.Speed = bs.Speed
+		b.ID = bs.ID
+		b.Pos = bs.Pos
+		b.Rot = bs.Rot
+		b.Live.Progress = bs.Live
+		b.Live.Period = b.LiveTime
+		b.Group = bs.Group
+		b.Owner = bs.Owner
+	}
+
+	w.Player = -1
+	for _, id := range w.Tanks.Occupied() {
+		if w.Tanks.Item(id).Client == w.Client.ID {
+			w.Player = id
+			w.UpdateScore()
+			break
+		}
+	}
+}
+
+// Reconcile drops inputs server already applied and replays the rest on top
+// of authoritative state of local tank
+func (w *World) Reconcile(seq int) {
+	c := w.Client
+
+	i := 0
+	for i < len(c.Pending) && c.Pending[i].Seq <= seq {
+		i++
+	}
+	c.Pending = append(c.Pending[:0], c.Pending[i:]...)
+
+	if w.Player == -1 {
+		return
+	}
+
+	t := w.Tanks.Item(w.Player)
+	live := t.Input.Clone()
+	for i := range c.Pending {
+		w.Predict(t, &c.Pending[i])
+	}
+	copy(t.Input, live)
+}
+
+// Predict simulates movement of local tank with one input the same way server
+// will once it receives it
+func (w *World) Predict(t *Tank, in *InputMessage) {
+	delta := w.Delta
+	w.Delta = w.Step
+	w.Predicting = true
+
+	copy(t.Input, in.Input)
+	t.Aim = w.ClampAim(t, in.Aim)
+	w.StepTank(t)
+
+	w.Predicting = false
+	w.Delta = delta
+}
+
+// Leave disconnects from server and returns to main menu, err is displayed
+// on multiplayer screen
+func (w *World) Leave(err error) {
+	w.StopClient()
+	w.Player = -1
+	w.GameState = Menu
+
+	if w.Headless {
+		return
+	}
+
+	w.SetScene("main_menu")
+	if err != nil {
+		w.UIScenes["main_menu"].ID("net_status").Module.(*ui.Text).SetText(err.Error())
+	}
+}
+
+// StopClient closes connection to server
+func (w *World) StopClient() {
+	if w.Client == nil {
+		return
+	}
+
+	w.Client.Close()
+	w.Client = nil
+	w.Chat.Reset()
+	w.Step = 1. / TickRate
+	w.RestoreStats()
+}
+
+// UseStats replaces stats with stats of server for the session
+func (w *World) UseStats(s assets.Stats) {
+	local := w.Assets.Stats
+	w.LocalStats = &local
+	w.Assets.Stats = s
+}
+
+// RestoreStats switches back to own stats after session with server stats
+func (w *World) RestoreStats() {
+	if w.LocalStats == nil {
+		return
+	}
+
+	w.Assets.Stats = *w.LocalStats
+	w.LocalStats = nil
+}
+
+// DiffText joins first MaxDiff lines of stats difference
+func DiffText(diff []string) string {
+	if len(diff) > MaxDiff {
+		diff = append(diff[:MaxDiff], fmt.Sprintf("and %d more", len(diff)-MaxDiff))
+	}
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,77 @@
+package game
+
+import (
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// RamSpeed is closing speed tanks need for ram damage to apply, it keeps
+// tanks that just lean on each other from grinding health
+const RamSpeed = 100
+
+// CollideTanks pushes tank and tanks it overlaps apart by their Mass and
+// applies ram damage of enemies
+func (w *World) CollideTanks(t *Tank) {
+	area := mat.Square(t.Pos, t.Size*2)
+	w.Buff = w.Hasher.Query(area, w.Buff[:0], t.Group, false)
+	w.Buff = w.Hasher.Query(area, w.Buff, t.Group, true)
+	for _, id := range w.Buff {
+		o := w.Tanks.Item(id)
+		if o == t || o.Dead() {
+			continue
+		}
+
+		n := t.Pos.To(o.Pos)
+		l, r := n.Len(), t.Size+o.Size
+		if l >= r {
+			continue
+		}
+		if l == 0 {
+			n, l = mat.V(1, 0), 1
+		}
+		n = n.Scaled(1 / l)
+
+		mt, mo := t.Mass, o.Mass
+		if mt <= 0 || mo <= 0 {
+			mt, mo = 1, 1
+		}
+		overlap := r - l
+		t.Pos.SubE(n.Scaled(overlap * mo / (mt + mo)))
+		o.Pos.AddE(n.Scaled(overlap * mt / (mt + mo)))
+		w.Hasher.Update(&o.Address, o.Pos, o.ID, o.Group)
+
+		closing := t.Vel.Sub(o.Vel).Dot(n)
+		if closing <= 0 {
+			continue
+		}
+		j := closing / (1/mt + 1/mo)
+		t.Vel.SubE(n.Scaled(j / mt))
+		o.Vel.AddE(n.Scaled(j / mo))
+
+		if closing > RamSpeed && t.Group != o.Group && !w.Predicting {
+			w.Ram(o, t, closing)
+			w.Ram(t, o, closing)
+		}
+	}
+}
+
+// Ram deals ram damage of attacker to victim, kill is queued to Rammed
+func (w *World) Ram(victim, attacker *Tank, closing float64) {
+	damage := int(attacker.RamDamage * closing)
+	if damage <= 0 || victim.Dead() {
+		return
+	}
+
+	victim.Damage(damage, attacker.ID)
+	if victim.Dead() {
+		w.Rammed = append(w.Rammed, [2]int{attacker.ID, victim.ID})
+	}
+}
+
+// ResolveRams reports queued ram kills, pointers to tanks are invalid after
+// it as killers can level up
+func (w *World) ResolveRams() {
+	for _, k := range w.Rammed {
+		w.OnDeath(k[0], k[1])
+	}
+	w.Rammed = w.Rammed[:0]
+}
@@ -0,0 +1,140 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// duel creates tanks a and b of own copies of asset that can level up in
+// empty world, b is placed overlapping a by overlap
+func duel(t *testing.T, group int, overlap float64, edit func(a, b *assets.Tank)) (w *World, a, b int) {
+	w = emptyWorld(t)
+
+	// tank that can level up, so kills have consequences
+	var base assets.Tank
+	for _, c := range w.Assets.Tanks.Slice() {
+		if _, _, ok := w.Assets.Tanks.Tank(c.V.Next); ok && !w.DisabledEnemy[c.V.Next] {
+			base = c.V
+			break
+		}
+	}
+	if base.Name == "" {
+		t.Fatal("no tank can level up")
+	}
+	ta, tb := base, base
+	ta.Turrets, tb.Turrets = nil, nil
+	ta.MaxHealth, tb.MaxHealth = 1000, 1000
+	ta.Mass, tb.Mass, ta.RamDamage, tb.RamDamage = 1, 1, 0, 0
+	edit(&ta, &tb)
+
+	pos := w.Size.Scaled(.5)
+	a = w.CreateTank(false, 0, 1, pos, 0, 0, &ta).ID
+	b = w.CreateTank(false, 0, group, pos.Add(mat.V(ta.Size+tb.Size-overlap, 0)), 0, 0, &tb).ID
+	return
+}
+
+func TestCollideMass(t *testing.T) {
+	cases := []struct {
+		desc         string
+		ma, mb       float64
+		pushA, pushB float64
+		velA, velB   float64
+		before       float64
+	}{
+		{"equal", 1, 1, -2, 2, 5, 5, 10},
+		{"heavier b", 1, 3, -3, 1, 2.5, 2.5, 10},
+		{"heavier a", 3, 1, -1, 3, 7.5, 7.5, 10},
+		{"no mass", 0, 0, -2, 2, 5, 5, 10},
+		{"separating", 1, 3, -3, 1, -10, 0, -10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			w, a, b := duel(t, 1, 4, func(a, b *assets.Tank) {
+				a.Mass, b.Mass = c.ma, c.mb
+			})
+			ta, tb := w.Tanks.Item(a), w.Tanks.Item(b)
+			ta.Vel = mat.V(c.before, 0)
+			pa, pb := ta.Pos, tb.Pos
+
+			w.CollideTanks(ta)
+			if !near(ta.Pos.X-pa.X, c.pushA) || !near(tb.Pos.X-pb.X, c.pushB) {
+				t.Errorf("pushed by %v and %v, expected %v and %v", ta.Pos.X-pa.X, tb.Pos.X-pb.X, c.pushA, c.pushB)
+			}
+			if !near(ta.Vel.X, c.velA) || !near(tb.Vel.X, c.velB) {
+				t.Errorf("velocities %v and %v, expected %v and %v", ta.Vel.X, tb.Vel.X, c.velA, c.velB)
+			}
+			if p := w.Hasher.Adr(tb.Pos); p != tb.Address {
+				t.Errorf("pushed tank is at %v in hasher, should be at %v", tb.Address, p)
+			}
+		})
+	}
+}
+
+func TestRamDamage(t *testing.T) {
+	cases := []struct {
+		desc             string
+		group            int
+		speed            float64
+		predicting       bool
+		damageA, damageB int
+	}{
+		{"enemies", 2, 200, false, 40, 100},
+		{"slow", 2, RamSpeed * .9, false, 0, 0},
+		{"allies", 1, 200, false, 0, 0},
+		{"predicting", 2, 200, true, 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			w, a, b := duel(t, c.group, 1, func(a, b *assets.Tank) {
+				a.RamDamage, b.RamDamage = .5, .2
+			})
+			w.Predicting = c.predicting
+			ta, tb := w.Tanks.Item(a), w.Tanks.Item(b)
+			ta.Vel = mat.V(c.speed, 0)
+
+			w.CollideTanks(ta)
+			if da, db := 1000-ta.Health, 1000-tb.Health; da != c.damageA || db != c.damageB {
+				t.Fatalf("damage %d and %d, expected %d and %d", da, db, c.damageA, c.damageB)
+			}
+			if c.damageB != 0 && tb.Target != a {
+				t.Fatal("rammed tank does not target attacker")
+			}
+			if len(w.Rammed) != 0 {
+				t.Fatal("ram without kill was queued")
+			}
+		})
+	}
+}
+
+func TestRamKill(t *testing.T) {
+	var next string
+	w, a, b := duel(t, 2, 1, func(a, b *assets.Tank) {
+		a.RamDamage, a.NeededScore, b.Value = .5, 1, 5
+		b.MaxHealth = 50
+		next = a.Next
+	})
+	w.Tanks.Item(a).Vel = mat.V(200, 0)
+
+	// leveling up grows the storage while the killer is being stepped
+	w.Simulate(w.Step)
+	if w.Tanks.Used(a) || w.Tanks.Used(b) {
+		t.Fatal("killer or victim stayed in the world")
+	}
+	if len(w.Rammed) != 0 {
+		t.Fatal("ram kills were not resolved")
+	}
+	leveled := 0
+	for _, id := range w.Tanks.Occupied() {
+		tk := w.Tanks.Item(id)
+		if tk.Group == 1 && tk.Tank.Name == next {
+			leveled++
+		}
+	}
+	if leveled != 1 {
+		t.Fatalf("expected one leveled tank, found %d", leveled)
+	}
+}
@@ -0,0 +1,339 @@
+package game
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jakubDoka/mlok/logic/timer"
+	"github.com/jakubDoka/sterr"
+)
+
+var (
+	ErrCommand       = sterr.New("unknown command %q, try help")
+	ErrCommandArgs   = sterr.New("usage: %s")
+	ErrNoSession     = sterr.New("no client with id or name %q")
+	ErrProperty      = sterr.New("unknown property %q, settable are: %s")
+	ErrPropertyValue = sterr.New("invalid value %q for %s")
+	ErrKicked        = sterr.New("kicked: %s")
+)
+
+// MaxLogins is amount of wrong passwords client gets kicked after, each one
+// also counts as violation
+const MaxLogins = 3
+
+// ConsoleCommand is server console command, Args is minimal amount of arguments
+type ConsoleCommand struct {
+	Usage, Help string
+	Args        int
+	Run         func(w *World, args []string) (string, error)
+}
+
+// Commands are commands of server console, they are available on standard
+// input of dedicated server and to clients logged in as admin
+var Commands = map[string]*ConsoleCommand{
+	"list": {
+		Usage: "list",
+		Help:  "lists connected clients",
+		Run:   (*World).ListCommand,
+	},
+	"kick": {
+		Usage: "kick <client> [reason]",
+		Help:  "disconnects client, client is id or name",
+		Args:  1,
+		Run:   (*World).KickCommand,
+	},
+	"ban": {
+		Usage: "ban <client> [reason]",
+		Help:  "disconnects client and refuses its address until restart of server",
+		Args:  1,
+		Run:   (*World).BanCommand,
+	},
+	"map": {
+		Usage: "map <world>",
+		Help:  "starts match on world",
+		Args:  1,
+		Run:   (*World).MapCommand,
+	},
+	"restart": {
+		Usage: "restart",
+		Help:  "starts the match again",
+		Run:   (*World).RestartCommand,
+	},
+	"spawnrate": {
+		Usage: "spawnrate <seconds>",
+		Help:  "changes time between enemy spawns of running match",
+		Args:  1,
+		Run:   (*World).SpawnRateCommand,
+	},
+	"say": {
+		Usage: "say <text>",
+		Help:  "sends chat message to all clients",
+		Args:  1,
+		Run:   (*World).SayCommand,
+	},
+	"set": {
+		Usage: "set <property> <value>",
+		Help:  "changes world property of running match",
+		Args:  2,
+		Run:   (*World).SetCommand,
+	},
+}
+
+// Execute runs console command line and returns its output
+func (w *World) Execute(line string) string {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return ""
+	}
+
+	if args[0] == "help" {
+		return Help()
+	}
+
+	c, ok := Commands[args[0]]
+	if !ok {
+		return ErrCommand.Args(args[0]).Error()
+	}
+	if len(args)-1 < c.Args {
+		return ErrCommandArgs.Args(c.Usage).Error()
+	}
+
+	out, err := c.Run(w, args[1:])
+	if err != nil {
+		return err.Error()
+	}
+	return out
+}
+
+// Remote runs command of client, client has to log in first with
+// 'login <password>', server without password does not accept commands
+func (w *World) Remote(ss *Session, line string) string {
+	args := strings.Fields(line)
+	if len(args) != 0 && args[0] == "login" {
+		if w.Server.Password == "" || len(args) != 2 || args[1] != w.Server.Password {
+			ss.Logins++
+			w.Event("login_failed", "client", ss.ID, "name", ss.Name, "count", ss.Logins)
+			w.Violation(ss, "login")
+			if ss.Logins >= MaxLogins && ss.Kicked == nil {
+				w.Event("kick", "client", ss.ID, "name", ss.Name, "reason", "logins")
+				w.Kick(ss, "too many wrong passwords")
+			}
+			return "wrong password"
+		}
+		ss.Admin = true
+		w.Event("login", "client", ss.ID, "name", ss.Name)
+		return "logged in"
+	}
+
+	if !ss.Admin {
+		return "log in first with: login <password>"
+	}
+
+	w.Event("command", "client", ss.ID, "name", ss.Name, "command", line)
+	return w.Execute(line)
+}
+
+// Help lists all commands
+func Help() string {
+	names := make([]string, 0, len(Commands))
+	for k := range Commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("help - lists commands\nlogin <password> - makes client admin\n")
+	for _, n := range names {
+		fmt.Fprintf(&sb, "%s - %s\n", Commands[n].Usage, Commands[n].Help)
+	}
+	return sb.String()
+}
+
+// Find returns session with id or name
+func (s *Server) Find(client string) (*Session, error) {
+	id, err := strconv.Atoi(client)
+	for _, ss := range s.Sessions {
+		if ss.Name != "" && (err == nil && ss.ID == id || ss.Name == client) {
+			return ss, nil
+		}
+	}
+	return nil, ErrNoSession.Args(client)
+}
+
+// Kick sends reason to client and disconnects it before next tick
+func (w *World) Kick(ss *Session, reason string) {
+	r := ss.Message(Reject)
+	r.PutUint16(NetVersion)
+	r.PutString(reason)
+	ss.Send(r)
+	ss.Kicked = ErrKicked.Args(reason)
+}
+
+func (w *World) ListCommand(args []string) (string, error) {
+	s := w.Server
+	var sb strings.Builder
+
+	state := "lobby"
+	if w.GameState == MultiplayerServer {
+		state = "match"
+	}
+	fmt.Fprintf(&sb, "%s on %s, %d players\n", state, w.LobbyWorld(s.Lobby).Name, s.Players())
+
+	tanks := w.Assets.Tanks.Slice()
+	for _, ss := range s.Sessions {
+		if ss.Name == "" {
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%d %s %s", ss.ID, ss.Name, ss.Conn.RemoteAddr())
+		if p := s.Lobby.Player(ss.ID); p != nil {
+			fmt.Fprintf(&sb, " team %d", p.Team+1)
+			if p.Tank >= 0 && p.Tank < len(tanks) {
+				fmt.Fprintf(&sb, " %s", tanks[p.Tank].K)
+			}
+		}
+		if t := w.SessionTank(ss); t != nil {
+			fmt.Fprintf(&sb, " score %d", t.Score)
+		}
+		if ss.Violations != 0 {
+			fmt.Fprintf(&sb, " violations %d", ss.Violations)
+		}
+		if ss.Admin {
+			sb.WriteString(" admin")
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String(), nil
+}
+
+func (w *World) KickCommand(args []string) (string, error) {
+	ss, err := w.Server.Find(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	reason := strings.Join(args[1:], " ")
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+	w.Kick(ss, reason)
+
+	return fmt.Sprintf("kicked %d %s", ss.ID, ss.Name), nil
+}
+
+func (w *World) BanCommand(args []string) (string, error) {
+	ss, err := w.Server.Find(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	reason := strings.Join(args[1:], " ")
+	if reason == "" {
+		reason = "banned by admin"
+	}
+	host, _, _ := net.SplitHostPort(ss.Conn.RemoteAddr().String())
+	w.Server.Bans[host] = true
+	w.Kick(ss, reason)
+
+	return fmt.Sprintf("banned %d %s (%s)", ss.ID, ss.Name, host), nil
+}
+
+func (w *World) MapCommand(args []string) (string, error) {
+	_, idx, ok := w.Assets.Worlds.World(args[0])
+	if !ok {
+		return "", ErrNoWorld.Args(args[0])
+	}
+
+	l := w.Server.Lobby
+	l.World = idx
+	for i := range l.Players {
+		w.FixChoice(l, &l.Players[i])
+	}
+	l.Dirty = true
+	w.Server.Restart = true
+
+	return "starting " + args[0], nil
+}
+
+func (w *World) RestartCommand(args []string) (string, error) {
+	w.Server.Restart = true
+	return "restarting", nil
+}
+
+func (w *World) SpawnRateCommand(args []string) (string, error) {
+	v, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || v <= 0 {
+		return "", ErrPropertyValue.Args(args[0], "spawnrate")
+	}
+
+	w.SetSpawnRate(v)
+
+	return fmt.Sprintf("spawn rate is %g", v), nil
+}
+
+// SetSpawnRate changes spawn rate and restarts spawn timer so change applies
+// right away
+func (w *World) SetSpawnRate(v float64) {
+	w.World.SpawnRate = v
+	w.Spawning = timer.Period(v)
+}
+
+func (w *World) SayCommand(args []string) (string, error) {
+	text := strings.Join(args, " ")
+	if len(text) > MaxChat {
+		text = text[:MaxChat]
+	}
+	w.Server.Chats = append(w.Server.Chats, ChatMessage{From: "server", Text: text})
+	return "", nil
+}
+
+func (w *World) SetCommand(args []string) (string, error) {
+	props := w.Properties()
+	p, ok := props[args[0]]
+	if !ok {
+		names := make([]string, 0, len(props))
+		for k := range props {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return "", ErrProperty.Args(args[0], strings.Join(names, ", "))
+	}
+
+	switch v := p.(type) {
+	case *float64:
+		f, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || f <= 0 {
+			return "", ErrPropertyValue.Args(args[1], args[0])
+		}
+		*v = f
+	case func(float64):
+		f, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || f <= 0 {
+			return "", ErrPropertyValue.Args(args[1], args[0])
+		}
+		v(f)
+	case *int:
+		i, err := strconv.Atoi(args[1])
+		if err != nil || i < 1 {
+			return "", ErrPropertyValue.Args(args[1], args[0])
+		}
+		*v = i
+	}
+
+	return fmt.Sprintf("%s is %s", args[0], args[1]), nil
+}
+
+// Properties returns world properties that can be changed with set command,
+// keys match names used in goss, properties with side effects have setters
+func (w *World) Properties() map[string]interface{} {
+	return map[string]interface{}{
+		"friction":      &w.World.Friction,
+		"spawn_rate":    w.SetSpawnRate,
+		"spawn_scaling": &w.World.SpawnScaling,
+		"team_count":    &w.World.TeamCount,
+	}
+}
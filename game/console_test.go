@@ -0,0 +1,50 @@
+package game
+
+import "testing"
+
+func TestSetSpawnRateRestartsTimer(t *testing.T) {
+	for _, cmd := range [][]string{{"spawnrate", "7"}, {"set", "spawn_rate", "7"}} {
+		w := testWorld(t, "hard", 1)
+		simulate(w, 10)
+
+		var err error
+		if cmd[0] == "set" {
+			_, err = w.SetCommand(cmd[1:])
+		} else {
+			_, err = w.SpawnRateCommand(cmd[1:])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.World.SpawnRate != 7 || w.Spawning.Period != 7 || w.Spawning.Progress != 0 {
+			t.Fatalf("%v: rate %g, timer %+v", cmd, w.World.SpawnRate, w.Spawning)
+		}
+	}
+}
+
+func TestWrongPasswordsKick(t *testing.T) {
+	s := host(t, TCP{}, "hard")
+	s.Server.Password = "secret"
+	ss := session(t, s)
+
+	if r := s.Remote(ss, "login wrong"); r != "wrong password" {
+		t.Fatalf("unexpected response %q", r)
+	}
+	if r := s.Remote(ss, "login secret"); r != "logged in" || !ss.Admin {
+		t.Fatalf("unexpected response %q", r)
+	}
+
+	ss = session(t, s)
+	for i := 1; i <= MaxLogins; i++ {
+		if ss.Kicked != nil {
+			t.Fatalf("kicked after %d wrong passwords", i-1)
+		}
+		s.Remote(ss, "login wrong")
+		if ss.Logins != i || ss.Violations != i {
+			t.Fatalf("logins %d, violations %d after %d wrong passwords", ss.Logins, ss.Violations, i)
+		}
+	}
+	if ss.Kicked == nil || ss.Admin {
+		t.Fatal("client was not kicked")
+	}
+}
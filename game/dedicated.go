@@ -0,0 +1,163 @@
+package game
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jakubDoka/mlok/load"
+	"github.com/jakubDoka/sterr"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// MaxServerRate is maximal tick rate of dedicated server
+const MaxServerRate = 1000
+
+var (
+	ErrNoWorld  = sterr.New("world %q does not exist")
+	ErrAssets   = sterr.New("assets contain fatal errors")
+	ErrTickRate = sterr.New("tick rate has to be between 1 and %d")
+)
+
+// RunServer runs dedicated server without window, args are command line
+// arguments after 'server', it returns once process is interrupted
+func RunServer(args []string) error {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	port := fs.Int("port", DefaultPort, "port to listen on")
+	name := fs.String("world", "", "world to preselect in lobby, first one if empty")
+	mods := fs.String("mods", "", "comma separated mod paths, mods from config.json if empty")
+	players := fs.Int("players", 0, "maximal amount of players, 0 means no limit")
+	rate := fs.Int("tickrate", TickRate, "simulation ticks per second")
+	password := fs.String("admin", "", "password clients log in with to run commands, empty disables remote commands")
+	transport := fs.String("transport", "tcp", "tcp or udp")
+	violations := fs.Int("violations", DefaultViolations, "invalid inputs after which client is kicked, 0 disables kicking")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *rate < 1 || *rate > MaxServerRate {
+		return ErrTickRate.Args(MaxServerRate)
+	}
+
+	t, err := TransportOf(*transport)
+	if err != nil {
+		return err
+	}
+
+	a := assets.NAssets()
+	a.Load("assets", assets.RawAssets)
+	if *mods != "" {
+		a.Mods = strings.Split(*mods, ",")
+	}
+	for _, p := range a.Mods {
+		a.Load(p, load.OS)
+	}
+	a.Compile()
+
+	w := NHeadlessWorld(a)
+	w.EventLog = os.Stdout
+	w.Step = 1 / float64(*rate)
+
+	fatal := false
+	for _, e := range a.Errors {
+		w.Event("asset_error", "error", e)
+		fatal = fatal || strings.Contains(e.Error(), "[fatal]")
+	}
+	if fatal {
+		return ErrAssets
+	}
+
+	worlds := a.Worlds.Slice()
+	if len(worlds) == 0 {
+		return ErrNoWorld.Args(*name)
+	}
+	world := &worlds[0].V
+	if *name != "" {
+		var ok bool
+		world, _, ok = a.Worlds.World(*name)
+		if !ok {
+			return ErrNoWorld.Args(*name)
+		}
+	}
+
+	err = w.Host(world, t, *port)
+	if err != nil {
+		return err
+	}
+	w.Server.MaxPlayers = *players
+	w.Server.Password = *password
+	w.Server.MaxViolations = *violations
+	w.Event("server_start", "transport", t.Name(), "port", w.Server.Port(), "world", world.Name, "tickrate", *rate, "players", *players)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) * w.Step))
+	defer ticker.Stop()
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+
+	last := time.Now()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// no console, for example server runs as service
+				lines = nil
+				continue
+			}
+			if out := w.Execute(line); out != "" {
+				fmt.Println(strings.TrimSuffix(out, "\n"))
+			}
+		case s := <-sig:
+			w.Event("shutdown", "signal", s)
+			w.StopServer()
+			return nil
+		case now := <-ticker.C:
+			w.Serve(now.Sub(last).Seconds())
+			last = now
+		}
+	}
+}
+
+// Serve runs one step of dedicated server, matches are started from lobby
+// and once all players leave the lobby opens again
+func (w *World) Serve(delta float64) {
+	switch w.GameState {
+	case InLobby:
+		w.UpdateLobby(delta)
+	case MultiplayerServer:
+		w.Advance(delta)
+		if w.Server.Players() == 0 {
+			w.Event("match_end", "world", w.World.Name, "ticks", w.Ticks)
+			w.ReopenLobby()
+		}
+	}
+}
+
+// ReopenLobby ends the match and waits in lobby for players to get ready again
+func (w *World) ReopenLobby() {
+	l := w.Server.Lobby
+	for i := range l.Players {
+		l.Players[i].Ready = false
+	}
+	l.Dirty = true
+
+	w.Tanks.Clear()
+	w.Bullets.Clear()
+	w.GameState = InLobby
+}
@@ -0,0 +1,299 @@
+package game
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jakubDoka/mlok/ggl/ui"
+	"github.com/jakubDoka/mlok/logic/netw"
+)
+
+// discovery properties
+const (
+	DiscoveryPort  = DefaultPort + 1
+	AnnouncePeriod = time.Second
+	// AnnounceTimeout is how long game stays listed after its last announcement
+	AnnounceTimeout = AnnouncePeriod * 3
+	// AnnounceMagic starts each announcement so stray packets are ignored
+	AnnounceMagic = "go-tanks"
+	// MaxAnnouncement is size of announcement read buffer
+	MaxAnnouncement = 512
+)
+
+// Announcement is what server tells the local network about itself
+//
+// format: magic string, version uint16, port uint16, players uint16, name
+// string, map string, transport string
+type Announcement struct {
+	// Addr is address to connect to, receiver fills it from sender ip, Port
+	// and Transport
+	Addr                   string
+	Name, Map, Transport   string
+	Version, Port, Players int
+	Seen                   time.Time
+}
+
+// Write writes announcement
+func (a *Announcement) Write(b *netw.Buffer) {
+	b.PutString(AnnounceMagic)
+	b.PutUint16(uint16(a.Version))
+	b.PutUint16(uint16(a.Port))
+	b.PutUint16(uint16(a.Players))
+	b.PutString(a.Name)
+	b.PutString(a.Map)
+	b.PutString(a.Transport)
+}
+
+// Read reads announcement, names are cleaned as they end up in ui
+func (a *Announcement) Read(b *netw.Buffer) error {
+	if b.String() != AnnounceMagic {
+		return ErrNetCorrupt
+	}
+	a.Version = int(b.Uint16())
+	a.Port = int(b.Uint16())
+	a.Players = int(b.Uint16())
+	a.Name = CleanName(b.String())
+	a.Map = CleanName(b.String())
+	a.Transport = b.String()
+	if b.Failed {
+		return ErrNetCorrupt
+	}
+	return nil
+}
+
+// Beacon periodically sends announcements to broadcast address and loopback
+// so even processes on the same machine without network find each other
+type Beacon struct {
+	Conn    *net.UDPConn
+	Targets []*net.UDPAddr
+
+	last time.Time
+	buff netw.Buffer
+}
+
+// NBeacon opens socket for announcing
+func NBeacon() (*Beacon, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Beacon{
+		Conn: conn,
+		Targets: []*net.UDPAddr{
+			{IP: net.IPv4bcast, Port: DiscoveryPort},
+			{IP: net.IPv4(127, 0, 0, 1), Port: DiscoveryPort},
+		},
+	}, nil
+}
+
+// Announce sends announcement if AnnouncePeriod passed since the last one,
+// failures are ignored as network may not allow broadcast
+func (b *Beacon) Announce(a *Announcement) {
+	if time.Since(b.last) < AnnouncePeriod {
+		return
+	}
+	b.last = time.Now()
+
+	b.buff.Clear()
+	a.Write(&b.buff)
+	for _, t := range b.Targets {
+		b.Conn.WriteToUDP(b.buff.Data, t)
+	}
+}
+
+// Close closes the socket
+func (b *Beacon) Close() {
+	b.Conn.Close()
+}
+
+// Discovery listens for announcements, Games are currently visible games of
+// matching version sorted by address
+type Discovery struct {
+	Conn  *net.UDPConn
+	Found chan Announcement
+	Games []Announcement
+}
+
+// NDiscovery starts listening on port
+func NDiscovery(port int) (*Discovery, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Discovery{
+		Conn:  conn,
+		Found: make(chan Announcement, 16),
+	}
+
+	go d.read()
+
+	return d, nil
+}
+
+func (d *Discovery) read() {
+	data := make([]byte, MaxAnnouncement)
+	for {
+		n, from, err := d.Conn.ReadFromUDP(data)
+		if err != nil {
+			close(d.Found)
+			return
+		}
+
+		var a Announcement
+		b := netw.Buffer{Data: data[:n]}
+		if a.Read(&b) != nil || a.Version != NetVersion {
+			continue
+		}
+		t, err := TransportOf(a.Transport)
+		if err != nil {
+			continue
+		}
+		a.Addr = JoinScheme(t, net.JoinHostPort(from.IP.String(), strconv.Itoa(a.Port)))
+
+		select {
+		case d.Found <- a:
+		default:
+		}
+	}
+}
+
+// Update takes received announcements and drops games that stopped announcing,
+// it returns whether list changed
+func (d *Discovery) Update() (changed bool) {
+	now := time.Now()
+
+	for receiving := true; receiving; {
+		select {
+		case a, ok := <-d.Found:
+			if !ok {
+				receiving = false
+				continue
+			}
+			a.Seen = now
+			i := sort.Search(len(d.Games), func(i int) bool { return d.Games[i].Addr >= a.Addr })
+			if i < len(d.Games) && d.Games[i].Addr == a.Addr {
+				old := d.Games[i]
+				d.Games[i] = a
+				changed = changed || old.Name != a.Name || old.Map != a.Map || old.Players != a.Players
+				continue
+			}
+			d.Games = append(d.Games, Announcement{})
+			copy(d.Games[i+1:], d.Games[i:])
+			d.Games[i] = a
+			changed = true
+		default:
+			receiving = false
+		}
+	}
+
+	for i := 0; i < len(d.Games); i++ {
+		if now.Sub(d.Games[i].Seen) > AnnounceTimeout {
+			d.Games = append(d.Games[:i], d.Games[i+1:]...)
+			i--
+			changed = true
+		}
+	}
+
+	return
+}
+
+// Close stops listening
+func (d *Discovery) Close() {
+	d.Conn.Close()
+}
+
+// Announce lets local network know about hosted game
+func (w *World) Announce() {
+	s := w.Server
+	if s.Beacon == nil {
+		return
+	}
+
+	s.Beacon.Announce(&Announcement{
+		Name:      s.Name,
+		Map:       w.Assets.Worlds.Slice()[s.Lobby.World].K,
+		Transport: s.Transport.Name(),
+		Version:   NetVersion,
+		Port:      s.Port(),
+		Players:   len(s.Lobby.Players),
+	})
+}
+
+// HostName returns name server announces itself with
+func HostName() string {
+	name, _ := os.Hostname()
+	if name = CleanName(name); name == "" {
+		name = "tanks"
+	}
+	return name
+}
+
+// StartDiscovery starts listening for games on local network
+func (w *World) StartDiscovery() error {
+	w.StopDiscovery()
+
+	d, err := NDiscovery(DiscoveryPort)
+	if err != nil {
+		return err
+	}
+	w.Discovery = d
+	w.UpdateGameList()
+
+	return nil
+}
+
+// StopDiscovery stops listening for games
+func (w *World) StopDiscovery() {
+	if w.Discovery == nil {
+		return
+	}
+
+	w.Discovery.Close()
+	w.Discovery = nil
+}
+
+// Discover updates list of discovered games
+func (w *World) Discover() {
+	if w.Discovery.Update() {
+		w.UpdateGameList()
+	}
+}
+
+// UpdateGameList displays discovered games on multiplayer screen
+func (w *World) UpdateGameList() {
+	if w.Headless {
+		return
+	}
+
+	scene := w.UIScenes["main_menu"]
+	list := scene.ID("game_list")
+	status := scene.ID("net_status").Module.(*ui.Text)
+	for list.ChildCount() != 0 {
+		list.PopChild(0)
+	}
+
+	for _, a := range w.Discovery.Games {
+		name := fmt.Sprintf("%s (%s) %s, %d players", a.Name, a.Addr, a.Map, a.Players)
+		err := list.AddGoml(gomlTemp(`<option name=%q button_text="Join"/>`, name))
+		if err != nil {
+			panic(err)
+		}
+
+		addr := a.Addr
+		scene.ID(name).Listen(ui.Click, func(i interface{}) {
+			status.SetText("")
+			err := w.Connect(addr, "")
+			if err != nil {
+				status.SetText(err.Error())
+			}
+		})
+	}
+
+	scene.Redraw.Notify()
+}
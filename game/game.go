@@ -2,8 +2,13 @@ package game
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jakubDoka/mlok/ggl"
 	"github.com/jakubDoka/mlok/ggl/ui"
@@ -16,7 +21,6 @@ type Game struct {
 	*ggl.Window
 	*assets.Assets
 	*World
-	*Net
 
 	Closed bool
 }
@@ -53,6 +57,8 @@ func NGame() *Game {
 	g.SetupMainMenu()
 	g.SetupEndScreen()
 	g.SetupSinglePlayer()
+	g.SetupReplay()
+	g.SetupLobby()
 
 	return g
 }
@@ -70,6 +76,13 @@ func (g *Game) SetupMainMenu() {
 	mod_list := scene.ID("mod_list")
 	mod_status := scene.ID("mod_status").Module.(*ui.Text)
 	mod_input := scene.ID("mod_input").Module.(*ui.Area)
+	replays := scene.ID("replays")
+	replay_list := scene.ID("replay_list")
+	replay_status := scene.ID("replay_status").Module.(*ui.Text)
+	multiplayer := scene.ID("multiplayer")
+	host_list := scene.ID("host_list")
+	net_status := scene.ID("net_status").Module.(*ui.Text)
+	net_input := scene.ID("net_input").Module.(*ui.Area)
 
 	var update_list func()
 
@@ -108,8 +121,18 @@ func (g *Game) SetupMainMenu() {
 	scene.ID("Exit").Listen(ui.Click, func(i interface{}) {
 		g.Closed = true
 	})
+	cont := scene.ID("Continue")
+	cont.SetHidden(!g.HasSave())
+	cont.Listen(ui.Click, func(i interface{}) {
+		err := g.ContinueMatch()
+		if err != nil {
+			fmt.Println(err)
+		}
+		cont.SetHidden(!g.HasSave())
+	})
 	back.Listen(ui.Click, func(i interface{}) {
 		change(main, false)
+		g.StopDiscovery()
 	})
 	scene.ID("Singleplayer").Listen(ui.Click, func(i interface{}) {
 		change(maps, true)
@@ -117,6 +140,64 @@ func (g *Game) SetupMainMenu() {
 	scene.ID("Mods").Listen(ui.Click, func(i interface{}) {
 		change(mods, true)
 	})
+	scene.ID("Multiplayer").Listen(ui.Click, func(i interface{}) {
+		change(multiplayer, true)
+		net_status.SetText("")
+		err := g.StartDiscovery()
+		if err != nil {
+			net_status.SetText(err.Error())
+		}
+	})
+	scene.ID("net_connect").Listen(ui.Click, func(i interface{}) {
+		addr := string(net_input.Content)
+		if addr == "" {
+			net_status.SetText("nothing to connect to")
+			return
+		}
+
+		net_status.SetText("")
+		err := g.Connect(addr, "")
+		if err != nil {
+			net_status.SetText(err.Error())
+		}
+	})
+	scene.ID("Replays").Listen(ui.Click, func(i interface{}) {
+		change(replays, true)
+		replay_status.SetText("")
+
+		for replay_list.ChildCount() != 0 {
+			replay_list.PopChild(0)
+		}
+
+		dir := path.Join(g.AppData.Root, ReplayDir)
+		files, _ := ioutil.ReadDir(dir)
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Name() > files[j].Name()
+		})
+
+		for _, f := range files {
+			if path.Ext(f.Name()) != ReplayExt {
+				continue
+			}
+
+			p := path.Join(dir, f.Name())
+			name := f.Name()
+			if stamp, err := strconv.ParseInt(strings.TrimSuffix(name, ReplayExt), 10, 64); err == nil {
+				name = time.Unix(stamp, 0).Format("2006-01-02 15:04:05")
+			}
+
+			err := replay_list.AddGoml(gomlTemp(`<option name=%q button_text="Watch"/>`, name))
+			if err != nil {
+				panic(err)
+			}
+			scene.ID(name).Listen(ui.Click, func(i interface{}) {
+				err := g.Watch(p)
+				if err != nil {
+					replay_status.SetText(err.Error())
+				}
+			})
+		}
+	})
 
 	scene.ID("mod_submit").Listen(ui.Click, func(i interface{}) {
 		p := string(mod_input.Content)
@@ -145,7 +226,23 @@ func (g *Game) SetupMainMenu() {
 			panic(err)
 		}
 		scene.ID(c.K).Listen(ui.Click, func(i interface{}) {
-			g.LoadMap(true, &c.V)
+			g.LoadMap(Singleplayer, &c.V)
+		})
+
+		// option name is also its id so it has to differ from the map option
+		host := "Host " + c.K
+		err = host_list.AddGoml(gomlTemp(`<option name="%s" button_text="Open"/>`, host))
+		if err != nil {
+			panic(err)
+		}
+		scene.ID(host).Listen(ui.Click, func(i interface{}) {
+			t, err := TransportOf(g.Transport)
+			if err == nil {
+				err = g.Host(&c.V, t, DefaultPort)
+			}
+			if err != nil {
+				net_status.SetText(err.Error())
+			}
 		})
 	}
 
@@ -179,16 +276,20 @@ func (g *Game) SetupEndScreen() {
 	})
 
 	scene.ID("Retry").Listen(ui.Click, func(i interface{}) {
-		g.LoadMap(true, g.Original)
+		g.LoadMap(Singleplayer, g.Original)
 	})
 }
 
 func (g *Game) SetupSinglePlayer() {
 	scene := g.Assets.UIScenes["singleplayer"]
+	g.SetupChat(scene)
 
 	scene.ID("Menu").Listen(ui.Click, func(i interface{}) {
 		scene.ID("poppup").SetHidden(false)
-		g.GameState = Menu
+		// hosted match keeps running for other players
+		if g.GameState == Singleplayer {
+			g.GameState = Menu
+		}
 	})
 
 	scene.ID("Exit").Listen(ui.Click, func(i interface{}) {
@@ -197,8 +298,131 @@ func (g *Game) SetupSinglePlayer() {
 
 	scene.ID("Resume").Listen(ui.Click, func(i interface{}) {
 		scene.ID("poppup").SetHidden(true)
-		g.GameState = Singleplayer
+		if g.GameState == Menu {
+			g.GameState = Singleplayer
+		}
 	})
+
+	scene.ID("Save & Quit").Listen(ui.Click, func(i interface{}) {
+		err := g.SaveMatch()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		g.SaveRecording()
+		g.Player = -1
+		g.SetScene("main_menu")
+		g.UIScenes["main_menu"].ID("Continue").SetHidden(false)
+	})
+}
+
+func (g *Game) SetupLobby() {
+	scene := g.Assets.UIScenes["lobby"]
+	g.SetupChat(scene)
+	maps := scene.ID("lobby_maps")
+
+	s := g.Assets.Worlds.Slice()
+	for i := range s {
+		idx := i
+		err := maps.AddGoml(gomlTemp(`<option name="%s" button_text="Pick"/>`, s[i].K))
+		if err != nil {
+			panic(err)
+		}
+		scene.ID(s[i].K).Listen(ui.Click, func(i interface{}) {
+			g.PickWorld(idx)
+		})
+	}
+
+	scene.ID("Team").Listen(ui.Click, func(i interface{}) {
+		g.NextTeam()
+	})
+
+	scene.ID("Tank").Listen(ui.Click, func(i interface{}) {
+		g.NextTank()
+	})
+
+	scene.ID("Ready").Listen(ui.Click, func(i interface{}) {
+		g.ToggleReady()
+	})
+
+	scene.ID("Leave").Listen(ui.Click, func(i interface{}) {
+		g.LeaveLobby()
+	})
+}
+
+// SetupChat tracks whether chat input of scene was clicked
+func (g *Game) SetupChat(scene *ui.Scene) {
+	input := scene.ID("chat_input")
+	input.Listen(ui.Select, func(i interface{}) {
+		g.Chat.Selected = true
+	})
+	input.Listen(ui.Deselect, func(i interface{}) {
+		g.Chat.Selected = false
+	})
+}
+
+func (g *Game) SetupReplay() {
+	scene := g.Assets.UIScenes["replay"]
+	kills := scene.ID("kill_list")
+
+	scene.ID("Menu").Listen(ui.Click, func(i interface{}) {
+		g.StopViewer()
+	})
+
+	scene.ID("Pause").Listen(ui.Click, func(i interface{}) {
+		g.TogglePause()
+	})
+
+	scene.ID("Slower").Listen(ui.Click, func(i interface{}) {
+		g.SetSpeed(-1)
+	})
+
+	scene.ID("Faster").Listen(ui.Click, func(i interface{}) {
+		g.SetSpeed(1)
+	})
+
+	scene.ID("Follow").Listen(ui.Click, func(i interface{}) {
+		g.Viewer.Follow = true
+	})
+
+	scene.ID("Kills").Listen(ui.Click, func(i interface{}) {
+		kills.SetHidden(!kills.Hidden())
+	})
+}
+
+// Watch loads replay from file and opens it in replay viewer
+func (g *Game) Watch(p string) error {
+	r, err := LoadReplay(p)
+	if err != nil {
+		return err
+	}
+
+	err = g.WatchReplay(r)
+	if err != nil {
+		return err
+	}
+
+	scene := g.Assets.UIScenes["replay"]
+	kills := scene.ID("kill_list")
+	for kills.ChildCount() != 0 {
+		kills.PopChild(0)
+	}
+
+	for i, k := range r.Kills {
+		name := fmt.Sprintf("%d. %s", i+1, k)
+		err := kills.AddGoml(gomlTemp(`<option name=%q button_text="Jump"/>`, name))
+		if err != nil {
+			panic(err)
+		}
+
+		tick := k.Tick
+		scene.ID(name).Listen(ui.Click, func(i interface{}) {
+			g.Seek(tick - TickRate*2)
+		})
+	}
+
+	return nil
 }
 
 func gomlTemp(str string, args ...interface{}) []byte {
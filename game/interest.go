@@ -0,0 +1,132 @@
+package game
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jakubDoka/mlok/logic/spatial"
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// interest management properties, all in world units
+const (
+	// InterestMargin is added around client view so entities are known before
+	// they show up on the screen
+	InterestMargin = 300
+	// InterestKeep is how much further entity has to get before client stops
+	// receiving it, entities on the edge are not dropped and sent again
+	InterestKeep = 200
+	// MaxSight is maximal half size of view client can ask for
+	MaxSight = 2500
+)
+
+// DefaultSight is half size of view of client that did not tell its own yet
+var DefaultSight = mat.V(800, 500)
+
+// ViewRect returns area client is interested in
+func (ss *Session) ViewRect() mat.AABB {
+	sight := ss.Sight
+	if sight.X <= 0 || sight.Y <= 0 {
+		sight = DefaultSight
+	}
+	sight.X = math.Min(sight.X, MaxSight) + InterestMargin
+	sight.Y = math.Min(sight.Y, MaxSight) + InterestMargin
+
+	return mat.A(ss.Eye.X-sight.X, ss.Eye.Y-sight.Y, ss.Eye.X+sight.X, ss.Eye.Y+sight.Y)
+}
+
+// BulletHash indexes bullets of one snapshot by position so clients do not
+// each go over all of them, ids in Hasher are indexes into State.Bullets
+type BulletHash struct {
+	State     *WorldState
+	Addresses []mat.Point
+	Hasher    spatial.MinHash
+}
+
+// Index replaces hashed bullets with bullets of s
+func (h *BulletHash) Index(w *World, s *WorldState) {
+	if h.Hasher.Nodes == nil {
+		size := w.Size.Div(w.Tile).Point()
+		h.Hasher = spatial.NMinHash(size.X, size.Y, w.Tile)
+	}
+	if h.State != nil {
+		for i, b := range h.State.Bullets {
+			h.Hasher.Remove(h.Addresses[i], i, b.Group)
+		}
+	}
+
+	h.State = s
+	h.Addresses = h.Addresses[:0]
+	for i, b := range s.Bullets {
+		h.Addresses = append(h.Addresses, mat.Point{})
+		h.Hasher.Insert(&h.Addresses[i], b.Pos, i, b.Group)
+	}
+}
+
+// Clear forgets hashed bullets, hasher is rebuilt as next map can differ
+// in size
+func (h *BulletHash) Clear() {
+	*h = BulletHash{Addresses: h.Addresses[:0]}
+}
+
+// Query returns indexes of bullets in area sorted, so they are in order of ids
+func (h *BulletHash) Query(area mat.AABB, buff []int) []int {
+	// all groups, first the zero one and then the others
+	buff = h.Hasher.Query(area, buff[:0], 0, true)
+	buff = h.Hasher.Query(area, buff, 0, false)
+	sort.Ints(buff)
+	return buff
+}
+
+// Interest returns part of state session should receive, base is the state
+// client acknowledged, entities it already knows are kept a bit longer, own
+// tanks are always sent
+func (w *World) Interest(ss *Session, s, base *WorldState) *WorldState {
+	view := ss.ViewRect()
+	keep := view
+	keep.Min.SubE(mat.V(InterestKeep, InterestKeep))
+	keep.Max.AddE(mat.V(InterestKeep, InterestKeep))
+
+	knownTanks := map[int]bool{}
+	knownBullets := map[int]bool{}
+	if base != nil {
+		for _, t := range base.Tanks {
+			knownTanks[t.ID] = true
+		}
+		for _, b := range base.Bullets {
+			knownBullets[b.ID] = true
+		}
+	}
+
+	// all groups, first the zero one and then the others
+	w.Buff = w.Hasher.Query(keep, w.Buff[:0], 0, true)
+	w.Buff = w.Hasher.Query(keep, w.Buff, 0, false)
+	visible := make(map[int]bool, len(w.Buff))
+	for _, id := range w.Buff {
+		t := w.Tanks.Item(id)
+		if view.Contains(t.Pos) || knownTanks[id] && keep.Contains(t.Pos) {
+			visible[id] = true
+		}
+	}
+
+	own := &WorldState{Tick: s.Tick}
+	for _, t := range s.Tanks {
+		if visible[t.ID] || t.Client == ss.ID {
+			own.Tanks = append(own.Tanks, t)
+		}
+	}
+
+	index := &w.Server.Bullets
+	if index.State != s {
+		index.Index(w, s)
+	}
+	w.Buff = index.Query(keep, w.Buff)
+	for _, i := range w.Buff {
+		b := s.Bullets[i]
+		if view.Contains(b.Pos) || knownBullets[b.ID] && keep.Contains(b.Pos) {
+			own.Bullets = append(own.Bullets, b)
+		}
+	}
+
+	return own
+}
@@ -0,0 +1,89 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// TestInterestLoopback moves view of client far from its spawn, where only
+// entities with high ids are, and checks client gets them and nothing it
+// should not see
+func TestInterestLoopback(t *testing.T) {
+	for name, tr := range Transports {
+		t.Run(name, func(t *testing.T) {
+			s := host(t, tr, "hard")
+			c := join(t, s, "tester")
+			start(t, s, c)
+
+			ss := s.Server.Sessions[0]
+			own := s.SessionTank(ss)
+			if own == nil {
+				t.Fatal("client has no tank on server")
+			}
+			group, asset, ownID := own.Group, own.Tank, own.ID
+
+			// view is in the corner furthest from spawn
+			eye := mat.V(400, 400)
+			if own.Pos.X < s.Size.X/2 {
+				eye.X = s.Size.X - 400
+			}
+			if own.Pos.Y < s.Size.Y/2 {
+				eye.Y = s.Size.Y - 400
+			}
+			sight := mat.V(200, 200)
+			ss.Eye, ss.Sight = eye, sight
+			if ss.ViewRect().Contains(own.Pos) {
+				t.Fatal("map is too small to look away from spawn")
+			}
+
+			// fillers push ids of real entities up, they are removed before
+			// the world is simulated again
+			const fill = 1000
+			var tanks, bullets []int
+			for i := 0; i < fill; i++ {
+				_, id := s.Tanks.Allocate()
+				tanks = append(tanks, id)
+				_, id = s.Bullets.Allocate()
+				bullets = append(bullets, id)
+			}
+			far := s.CreateTank(false, 0, group, eye, 0, 0, asset).ID
+			hidden := s.CreateTank(false, 0, group, own.Pos.Add(mat.V(50, 0)), 0, 0, asset).ID
+			bullet := s.CreateBullet(eye.Add(mat.V(30, 30)), mat.Vec{}, group, far, 0, &asset.Turrets[0].Bullet).ID
+			for i := range tanks {
+				s.Tanks.Remove(tanks[i])
+				s.Bullets.Remove(bullets[i])
+			}
+			if far < fill || hidden < fill || bullet < fill {
+				t.Fatal("entities did not get high ids")
+			}
+
+			seq := 1
+			seen := false
+			until(t, s, func() bool {
+				in := InputMessage{Seq: seq, Acked: c.Client.Acked, View: c.Client.Acked, Input: Bindings, Eye: eye, Sight: sight}
+				b := c.Client.Message(InputFrame)
+				in.Write(b)
+				c.Client.Send(b)
+				seq++
+
+				// snapshot is a tick behind, so entities can move a bit
+				keep := ss.ViewRect()
+				slack := mat.V(InterestKeep+100, InterestKeep+100)
+				keep.Min.SubE(slack)
+				keep.Max.AddE(slack)
+				for _, id := range c.Tanks.Occupied() {
+					if id == hidden || id != ownID && s.Tanks.Used(id) && !keep.Contains(s.Tanks.Item(id).Pos) {
+						t.Fatalf("client received tank %d outside its view", id)
+					}
+				}
+				seen = seen || bullet < c.Bullets.Len() && c.Bullets.Used(bullet)
+				return far < c.Tanks.Len() && c.Tanks.Used(far) && c.Tanks.Used(ownID)
+			}, c)
+
+			if !seen {
+				t.Fatal("client did not receive bullet in its view")
+			}
+		})
+	}
+}
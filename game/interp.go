@@ -0,0 +1,187 @@
+package game
+
+import (
+	"math"
+
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/mlok/mat/angle"
+)
+
+// interpolation properties, all in ticks
+const (
+	// InterpDelay is how far behind the newest snapshot remote entities are
+	// displayed, two snapshot periods hide one late or lost snapshot
+	InterpDelay = SnapshotPeriod * 2
+	// MaxExtrapolation is how long entity keeps moving when snapshots stop coming
+	MaxExtrapolation = SnapshotPeriod * 3
+	// TrackLen is amount of samples kept for each entity
+	TrackLen = 4
+	// ClockCorrection is portion of clock error corrected each frame
+	ClockCorrection = .05
+)
+
+// Sample is state of entity in one snapshot, TurretRot holds rotation of
+// each turret
+type Sample struct {
+	Tick      int
+	Pos, Vel  mat.Vec
+	Rot       float64
+	TurretRot []float64
+}
+
+// Track is short history of entity samples, oldest first, Asset is index of
+// entity type so reused ids do not blend different entities
+type Track struct {
+	Asset   int
+	Samples []Sample
+}
+
+// Add appends sample, the oldest ones are dropped
+func (t *Track) Add(s Sample) {
+	if len(t.Samples) == TrackLen {
+		t.Samples = append(t.Samples[:0], t.Samples[1:]...)
+	}
+	t.Samples = append(t.Samples, s)
+}
+
+// At returns sample interpolated to tick, after the last sample it extrapolates
+// by velocity, but at most by MaxExtrapolation ticks of given length
+func (t *Track) At(tick, step float64) Sample {
+	s := t.Samples
+	if tick <= float64(s[0].Tick) {
+		return s[0]
+	}
+
+	for i := 1; i < len(s); i++ {
+		a, b := &s[i-1], &s[i]
+		if tick >= float64(b.Tick) {
+			continue
+		}
+
+		f := (tick - float64(a.Tick)) / float64(b.Tick-a.Tick)
+		r := Sample{
+			Pos:       a.Pos.Lerp(b.Pos, f),
+			Vel:       a.Vel.Lerp(b.Vel, f),
+			Rot:       LerpAngle(a.Rot, b.Rot, f),
+			TurretRot: b.TurretRot,
+		}
+		if len(a.TurretRot) == len(b.TurretRot) {
+			r.TurretRot = make([]float64, len(b.TurretRot))
+			for i := range r.TurretRot {
+				r.TurretRot[i] = LerpAngle(a.TurretRot[i], b.TurretRot[i], f)
+			}
+		}
+		return r
+	}
+
+	last := s[len(s)-1]
+	late := math.Min(tick-float64(last.Tick), MaxExtrapolation)
+	last.Pos.AddE(last.Vel.Scaled(late * step))
+	return last
+}
+
+// LerpAngle interpolates angles the shorter way
+func LerpAngle(a, b, t float64) float64 {
+	return a + angle.To(angle.Norm(a), angle.Norm(b))*t
+}
+
+// Track records snapshot into entity tracks, tracks of entities that are no
+// longer in snapshot are dropped
+func (w *World) Track(s *WorldState) {
+	c := w.Client
+
+	if c.Tracks == nil {
+		c.Tracks = map[int]*Track{}
+		c.BulletTracks = map[int]*Track{}
+		c.Clock = float64(s.Tick - InterpDelay)
+	}
+	c.Latest = s.Tick
+
+	present := make(map[int]bool, len(s.Tanks))
+	for _, ts := range s.Tanks {
+		present[ts.ID] = true
+		tr := c.Tracks[ts.ID]
+		if tr == nil || tr.Asset != ts.Tank {
+			tr = &Track{Asset: ts.Tank}
+			c.Tracks[ts.ID] = tr
+		}
+		tr.Add(Sample{
+			Tick:      s.Tick,
+			Pos:       ts.Pos,
+			Vel:       ts.Vel,
+			Rot:       ts.BaseRot,
+			TurretRot: ts.TurretRot,
+		})
+	}
+	for id := range c.Tracks {
+		if !present[id] {
+			delete(c.Tracks, id)
+		}
+	}
+
+	present = make(map[int]bool, len(s.Bullets))
+	for _, bs := range s.Bullets {
+		present[bs.ID] = true
+		tr := c.BulletTracks[bs.ID]
+		if tr == nil || tr.Asset != bs.Bullet {
+			tr = &Track{Asset: bs.Bullet}
+			c.BulletTracks[bs.ID] = tr
+		}
+		tr.Add(Sample{
+			Tick: s.Tick,
+			Pos:  bs.Pos,
+			Vel:  mat.Rad(bs.Rot, bs.Speed),
+			Rot:  bs.Rot,
+		})
+	}
+	for id := range c.BulletTracks {
+		if !present[id] {
+			delete(c.BulletTracks, id)
+		}
+	}
+}
+
+// Interpolate advances the render clock and moves remote tanks and all bullets
+// to their interpolated state, local tank is predicted instead
+func (w *World) Interpolate(delta float64) {
+	c := w.Client
+	if c.Tracks == nil {
+		return
+	}
+
+	c.Clock += delta / w.Step
+	target := float64(c.Latest - InterpDelay)
+	if math.Abs(target-c.Clock) > MaxExtrapolation*2 {
+		c.Clock = target
+	} else {
+		c.Clock += (target - c.Clock) * ClockCorrection
+	}
+
+	for _, id := range w.Tanks.Occupied() {
+		tr := c.Tracks[id]
+		if id == w.Player || tr == nil {
+			continue
+		}
+		s := tr.At(c.Clock, w.Step)
+		t := w.Tanks.Item(id)
+		t.Pos = s.Pos
+		t.BaseRot = s.Rot
+		for i := range t.Guns {
+			if i < len(s.TurretRot) {
+				t.Guns[i].Rot = s.TurretRot[i]
+			}
+		}
+		w.Hasher.Update(&t.Address, t.Pos, t.ID, t.Group)
+	}
+
+	for _, id := range w.Bullets.Occupied() {
+		tr := c.BulletTracks[id]
+		if tr == nil {
+			continue
+		}
+		s := tr.At(c.Clock, w.Step)
+		b := w.Bullets.Item(id)
+		b.Pos = s.Pos
+		b.Rot = s.Rot
+	}
+}
@@ -0,0 +1,85 @@
+package game
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jakubDoka/mlok/mat"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestTrackAt(t *testing.T) {
+	tr := Track{}
+	tr.Add(Sample{Tick: 10, Pos: mat.V(0, 0), Rot: 0, TurretRot: []float64{0}})
+	tr.Add(Sample{Tick: 20, Pos: mat.V(10, 20), Vel: mat.V(2, 0), Rot: 1, TurretRot: []float64{2}})
+
+	cases := []struct {
+		desc      string
+		tick      float64
+		pos       mat.Vec
+		rot, turr float64
+	}{
+		{"before first", 5, mat.V(0, 0), 0, 0},
+		{"first", 10, mat.V(0, 0), 0, 0},
+		{"middle", 15, mat.V(5, 10), .5, 1},
+		{"quarter", 12.5, mat.V(2.5, 5), .25, .5},
+		{"last", 20, mat.V(10, 20), 1, 2},
+		{"extrapolated", 22, mat.V(10+2*2*.5, 20), 1, 2},
+		{"capped", 20 + MaxExtrapolation + 100, mat.V(10+2*MaxExtrapolation*.5, 20), 1, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			s := tr.At(c.tick, .5)
+			if !near(s.Pos.X, c.pos.X) || !near(s.Pos.Y, c.pos.Y) {
+				t.Errorf("pos %v, expected %v", s.Pos, c.pos)
+			}
+			if !near(s.Rot, c.rot) {
+				t.Errorf("rot %v, expected %v", s.Rot, c.rot)
+			}
+			if len(s.TurretRot) != 1 || !near(s.TurretRot[0], c.turr) {
+				t.Errorf("turret rot %v, expected %v", s.TurretRot, c.turr)
+			}
+		})
+	}
+}
+
+func TestTrackDropsOldest(t *testing.T) {
+	tr := Track{}
+	for i := 0; i < TrackLen+2; i++ {
+		tr.Add(Sample{Tick: i})
+	}
+	if len(tr.Samples) != TrackLen || tr.Samples[0].Tick != 2 {
+		t.Fatalf("unexpected samples %v", tr.Samples)
+	}
+}
+
+func TestLerpAngle(t *testing.T) {
+	cases := []struct {
+		desc       string
+		a, b, f, r float64
+	}{
+		{"forward", 0, 1, .5, .5},
+		{"backward", 1, 0, .5, .5},
+		{"across pi", math.Pi - .1, -math.Pi + .1, .5, math.Pi},
+		{"across minus pi", -math.Pi + .1, math.Pi - .1, .5, -math.Pi},
+		{"across zero", -.2, .2, .25, -.1},
+		{"unnormalized", 2 * math.Pi, .4, .5, 2*math.Pi + .2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			r := LerpAngle(c.a, c.b, c.f)
+			// compare directions so full turns do not matter
+			if !near(math.Cos(r), math.Cos(c.r)) || !near(math.Sin(r), math.Sin(c.r)) {
+				t.Errorf("LerpAngle(%v, %v, %v) = %v, expected %v", c.a, c.b, c.f, r, c.r)
+			}
+			if math.Abs(r-c.a) > math.Pi*c.f+1e-9 {
+				t.Errorf("LerpAngle(%v, %v, %v) = %v turned the long way", c.a, c.b, c.f, r)
+			}
+		})
+	}
+}
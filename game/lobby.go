@@ -0,0 +1,434 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jakubDoka/mlok/ggl/ui"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// MaxName is maximal length of player name
+const MaxName = 16
+
+// LobbyPlayer is what player chose in lobby, Team is zero based and player
+// fights along the ai team with same number, Tank is index of tank or -1
+// if world lets players use no tank and random one is spawned
+type LobbyPlayer struct {
+	ID, Team, Tank int
+	Name           string
+	Ready          bool
+}
+
+// Write writes player choice
+func (p *LobbyPlayer) Write(b *netw.Buffer) {
+	b.PutUint16(uint16(p.Team))
+	b.PutInt16(int16(p.Tank))
+	b.PutBool(p.Ready)
+}
+
+// Read reads player choice
+func (p *LobbyPlayer) Read(b *netw.Buffer) {
+	p.Team = int(b.Uint16())
+	p.Tank = int(b.Int16())
+	p.Ready = b.Bool()
+}
+
+// Lobby is state of pre-game lobby, World is index of picked world, server
+// keeps it for the whole match so late players spawn with their choice too
+type Lobby struct {
+	World   int
+	Players []LobbyPlayer
+	// Dirty means clients have outdated lobby
+	Dirty bool
+}
+
+// Player returns player with given id or nil
+func (l *Lobby) Player(id int) *LobbyPlayer {
+	for i := range l.Players {
+		if l.Players[i].ID == id {
+			return &l.Players[i]
+		}
+	}
+	return nil
+}
+
+// Remove removes player with given id
+func (l *Lobby) Remove(id int) {
+	for i := range l.Players {
+		if l.Players[i].ID == id {
+			l.Players = append(l.Players[:i], l.Players[i+1:]...)
+			l.Dirty = true
+			return
+		}
+	}
+}
+
+// Ready returns whether there are players and all of them are ready
+func (l *Lobby) Ready() bool {
+	for _, p := range l.Players {
+		if !p.Ready {
+			return false
+		}
+	}
+	return len(l.Players) != 0
+}
+
+// Write writes lobby
+func (l *Lobby) Write(b *netw.Buffer) {
+	b.PutUint16(uint16(l.World))
+	b.PutUint32(uint32(len(l.Players)))
+	for i := range l.Players {
+		p := &l.Players[i]
+		b.PutUint32(uint32(p.ID))
+		b.PutString(p.Name)
+		p.Write(b)
+	}
+}
+
+// Read reads lobby
+func (l *Lobby) Read(b *netw.Buffer) {
+	l.World = int(b.Uint16())
+	l.Players = make([]LobbyPlayer, readLen(b))
+	for i := range l.Players {
+		p := &l.Players[i]
+		p.ID = int(b.Uint32())
+		p.Name = b.String()
+		p.Read(b)
+	}
+}
+
+// CleanName removes everything but letters, digits, '_' and '-' from name and
+// cuts it to MaxName, name ends up in ui markup
+func CleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, name)
+	if len(name) > MaxName {
+		name = name[:MaxName]
+	}
+	return name
+}
+
+// LobbyWorld returns world picked in lobby
+func (w *World) LobbyWorld(l *Lobby) *assets.World {
+	return &w.Assets.Worlds.Slice()[l.World].V
+}
+
+// LobbyTeams returns amount of teams player can pick from
+func (w *World) LobbyTeams(l *Lobby) int {
+	if c := w.LobbyWorld(l).TeamCount; c > 0 {
+		return c
+	}
+	return 1
+}
+
+// PlayerTanks returns indices of tanks player can pick in world
+func (w *World) PlayerTanks(world *assets.World) (r []int) {
+	for i, t := range w.Assets.Tanks.Slice() {
+		if !world.DisabledPlayer[t.K] {
+			r = append(r, i)
+		}
+	}
+	return
+}
+
+// FixChoice makes player choice valid for world picked in lobby, invalid tank
+// is replaced by world player tank or first allowed one
+func (w *World) FixChoice(l *Lobby, p *LobbyPlayer) {
+	if p.Team < 0 || p.Team >= w.LobbyTeams(l) {
+		p.Team = 0
+	}
+
+	world := w.LobbyWorld(l)
+	allowed := w.PlayerTanks(world)
+	for _, t := range allowed {
+		if t == p.Tank {
+			return
+		}
+	}
+
+	p.Tank = -1
+	if len(allowed) != 0 {
+		p.Tank = allowed[0]
+	}
+	if _, idx, ok := w.Assets.Tanks.Tank(world.Player); ok && !world.DisabledPlayer[world.Player] {
+		p.Tank = idx
+	}
+}
+
+// Host starts server on port of transport and opens lobby with world
+// preselected, match starts when all players are ready
+func (w *World) Host(world *assets.World, t Transport, port int) error {
+	s, err := NServer(t, port)
+	if err != nil {
+		return err
+	}
+
+	w.StopServer()
+	w.StopDiscovery()
+	w.Server = s
+	_, s.Lobby.World, _ = w.Assets.Worlds.World(world.Name)
+	w.GameState = InLobby
+
+	// dedicated server has no local player
+	if !w.Headless {
+		s.Lobby.Players = append(s.Lobby.Players, LobbyPlayer{Name: "host"})
+		w.FixChoice(s.Lobby, &s.Lobby.Players[0])
+		w.SetScene("lobby")
+		w.UpdateLobbyUI()
+	}
+
+	return nil
+}
+
+// UpdateLobby processes lobby messages and starts the match once everyone
+// is ready
+func (w *World) UpdateLobby(delta float64) {
+	if w.Client != nil {
+		if err := w.Sync(); err != nil {
+			w.Leave(err)
+		}
+		return
+	}
+
+	s := w.Server
+	w.Delta = delta
+	w.Receive()
+	w.SendEvents()
+
+	if s.Lobby.Ready() || s.Restart {
+		w.StartMatch()
+		return
+	}
+
+	if !s.Lobby.Dirty {
+		return
+	}
+	s.Lobby.Dirty = false
+
+	for _, ss := range s.Sessions {
+		if ss.Name == "" {
+			continue
+		}
+		b := ss.Message(LobbyState)
+		s.Lobby.Write(b)
+		ss.Send(b)
+	}
+	w.UpdateLobbyUI()
+}
+
+// StartMatch loads world picked in lobby and tells clients to do the same
+func (w *World) StartMatch() {
+	s := w.Server
+	s.Restart = false
+	s.Rewind.Clear()
+	s.Bullets.Clear()
+	for _, ss := range s.Sessions {
+		ss.Acked, ss.Seq = -1, 0
+		ss.Inputs = ss.Inputs[:0]
+		ss.Shooting, ss.Clicks = false, 0
+		ss.History = nil
+	}
+	w.LoadMap(MultiplayerServer, w.LobbyWorld(s.Lobby))
+	w.Event("match_start", "world", w.World.Name, "seed", w.World.Seed, "players", s.Players())
+
+	for _, ss := range s.Sessions {
+		if ss.Name != "" {
+			w.SendStart(ss)
+		}
+	}
+}
+
+// SendStart tells client to load the match
+func (w *World) SendStart(ss *Session) {
+	b := ss.Message(Start)
+	b.PutUint16(uint16(w.Server.Lobby.World))
+	b.PutInt64(w.World.Seed)
+	ss.Send(b)
+}
+
+// SpawnChoice spawns tank of client as it chose in lobby
+func (w *World) SpawnChoice(client int) {
+	p := w.Server.Lobby.Player(client)
+	if p == nil {
+		p = &LobbyPlayer{ID: client}
+		w.FixChoice(w.Server.Lobby, p)
+	}
+
+	if p.Tank == -1 {
+		w.RandomSpawn(true, client, p.Team+1)
+		return
+	}
+	w.SpawnTank(true, client, p.Team+1, &w.Assets.Tanks.Slice()[p.Tank].V)
+}
+
+// PickWorld changes world of the lobby, only host can do that, everyone
+// has to get ready again
+func (w *World) PickWorld(idx int) {
+	if w.Server == nil || w.GameState != InLobby {
+		return
+	}
+
+	l := w.Server.Lobby
+	l.World = idx
+	for i := range l.Players {
+		w.FixChoice(l, &l.Players[i])
+		l.Players[i].Ready = false
+	}
+	l.Dirty = true
+}
+
+// LocalChoice returns lobby and copy of local player choice
+func (w *World) LocalChoice() (l *Lobby, p LobbyPlayer, ok bool) {
+	id := 0
+	if w.Server != nil {
+		l = w.Server.Lobby
+	} else if w.Client != nil {
+		l, id = w.Client.Lobby, w.Client.ID
+	}
+	if l == nil {
+		return
+	}
+
+	lp := l.Player(id)
+	if lp == nil {
+		return
+	}
+
+	return l, *lp, true
+}
+
+// Choose changes choice of local player, client only asks server for it
+func (w *World) Choose(p LobbyPlayer) {
+	if w.Server != nil {
+		l := w.Server.Lobby
+		lp := l.Player(0)
+		lp.Team, lp.Tank, lp.Ready = p.Team, p.Tank, p.Ready
+		w.FixChoice(l, lp)
+		l.Dirty = true
+	} else if w.Client != nil {
+		b := w.Client.Message(LobbyChoice)
+		p.Write(b)
+		w.Client.Send(b)
+	}
+}
+
+// NextTeam switches local player to next team
+func (w *World) NextTeam() {
+	l, p, ok := w.LocalChoice()
+	if !ok {
+		return
+	}
+	p.Team = (p.Team + 1) % w.LobbyTeams(l)
+	w.Choose(p)
+}
+
+// NextTank switches local player to next allowed tank
+func (w *World) NextTank() {
+	l, p, ok := w.LocalChoice()
+	if !ok {
+		return
+	}
+
+	allowed := w.PlayerTanks(w.LobbyWorld(l))
+	if len(allowed) == 0 {
+		return
+	}
+	next := allowed[0]
+	for i, t := range allowed {
+		if t == p.Tank {
+			next = allowed[(i+1)%len(allowed)]
+			break
+		}
+	}
+	p.Tank = next
+	w.Choose(p)
+}
+
+// ToggleReady toggles ready state of local player
+func (w *World) ToggleReady() {
+	_, p, ok := w.LocalChoice()
+	if !ok {
+		return
+	}
+	p.Ready = !p.Ready
+	w.Choose(p)
+}
+
+// LeaveLobby disconnects from lobby or closes it if world hosts it
+func (w *World) LeaveLobby() {
+	if w.Client != nil {
+		w.Leave(nil)
+		return
+	}
+
+	w.StopServer()
+	w.GameState = Menu
+	if !w.Headless {
+		w.SetScene("main_menu")
+	}
+}
+
+// UpdateLobbyUI displays current lobby state
+func (w *World) UpdateLobbyUI() {
+	if w.Headless {
+		return
+	}
+
+	scene := w.UIScenes["lobby"]
+	list := scene.ID("lobby_players")
+	for list.ChildCount() != 0 {
+		list.PopChild(0)
+	}
+	scene.ID("lobby_maps").SetHidden(w.Server == nil)
+
+	l, local, ok := w.LocalChoice()
+	if l == nil {
+		scene.ID("lobby_world").Module.(*ui.Text).SetText("waiting for server")
+		scene.Redraw.Notify()
+		return
+	}
+
+	worlds := w.Assets.Worlds.Slice()
+	tanks := w.Assets.Tanks.Slice()
+	tankName := func(idx int) string {
+		if idx < 0 || idx >= len(tanks) {
+			return "random"
+		}
+		return tanks[idx].K
+	}
+
+	if l.World < len(worlds) {
+		scene.ID("lobby_world").Module.(*ui.Text).SetText(worlds[l.World].K)
+	}
+
+	for i, p := range l.Players {
+		name := fmt.Sprintf("%d. %s - team %d - %s", i+1, p.Name, p.Team+1, tankName(p.Tank))
+		status := "waiting"
+		if p.Ready {
+			status = "ready"
+		}
+		err := list.AddGoml(gomlTemp(`<option name=%q button_text=%q/>`, name, status))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if ok {
+		scene.ID("Team").Module.(*ui.Button).SetText(fmt.Sprintf("Team %d", local.Team+1))
+		scene.ID("Tank").Module.(*ui.Button).SetText(tankName(local.Tank))
+		ready := scene.ID("Ready").Module.(*ui.Button)
+		if local.Ready {
+			ready.SetText("Not ready")
+		} else {
+			ready.SetText("Ready")
+		}
+	}
+
+	scene.Redraw.Notify()
+}
@@ -0,0 +1,299 @@
+package game
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// navigation properties
+const (
+	// PathBudget is how many tiles all path searches can expand in one tick,
+	// tanks that did not get to search keep their old path until next tick
+	PathBudget = 4000
+	// MaxExpand is how many tiles one search can expand, when goal is not
+	// reached by then, path leads to the closest tile found
+	MaxExpand = 1000
+	// Repath is distance in tiles target has to move from goal of the path
+	// for path to be found again
+	Repath = 1.5
+	// CrowdCost is added to cost of tile for each tank in it
+	CrowdCost = 2
+)
+
+// NavGrid is navigation grid over world tiles, tiles overlapped by obstacles
+// and tiles marked in world file are blocked
+type NavGrid struct {
+	W, H int
+	Tile mat.Vec
+	// Cost multiplies length of path trough tile, zero means blocked
+	Cost   []float64
+	Budget int
+
+	open   navHeap
+	g      []float64
+	from   []int
+	stamp  []uint32
+	closed []uint32
+	search uint32
+}
+
+// Path is route AI tank follows to its target, Goal is target position
+// the route was found for
+type Path struct {
+	Points       []mat.Vec
+	Goal         mat.Vec
+	Next, Target int
+}
+
+// Reset forgets the route
+func (p *Path) Reset() {
+	p.Points = p.Points[:0]
+	p.Next = 0
+	p.Target = -1
+}
+
+// BuildNav creates navigation grid of loaded world
+func (w *World) BuildNav() {
+	size := w.Size.Div(w.Tile).Point()
+	n := &w.Nav
+	n.W, n.H, n.Tile = size.X, size.Y, w.Tile
+	n.Cost = make([]float64, n.W*n.H)
+	n.g = make([]float64, len(n.Cost))
+	n.from = make([]int, len(n.Cost))
+	n.stamp = make([]uint32, len(n.Cost))
+	n.closed = make([]uint32, len(n.Cost))
+	n.search = 0
+	if len(n.Cost) == 0 {
+		return
+	}
+	for i := range n.Cost {
+		n.Cost[i] = 1
+	}
+
+	for _, t := range w.Tiles {
+		for _, p := range t.At {
+			if p.X < 0 || p.Y < 0 || p.X >= n.W || p.Y >= n.H {
+				continue
+			}
+			if t.Blocked {
+				n.Cost[p.Y*n.W+p.X] = 0
+			} else {
+				n.Cost[p.Y*n.W+p.X] = t.Cost
+			}
+		}
+	}
+
+	// tile is blocked when obstacle overlaps circle inscribed to it
+	radius := math.Min(n.Tile.X, n.Tile.Y) / 2
+	for i := range w.Obstacles {
+		o := &w.Obstacles[i]
+		min, max := n.Adr(o.Bounds.Min), n.Adr(o.Bounds.Max)
+		for y := min.Y; y <= max.Y; y++ {
+			for x := min.X; x <= max.X; x++ {
+				if _, ok := Push(o, n.Center(x, y), radius); ok {
+					n.Cost[y*n.W+x] = 0
+				}
+			}
+		}
+	}
+}
+
+// Adr returns tile position belongs to
+func (n *NavGrid) Adr(pos mat.Vec) mat.Point {
+	x := int(mat.Clamp(math.Floor(pos.X/n.Tile.X), 0, float64(n.W-1)))
+	y := int(mat.Clamp(math.Floor(pos.Y/n.Tile.Y), 0, float64(n.H-1)))
+	return mat.P(x, y)
+}
+
+// Center returns center of tile
+func (n *NavGrid) Center(x, y int) mat.Vec {
+	return mat.V((float64(x)+.5)*n.Tile.X, (float64(y)+.5)*n.Tile.Y)
+}
+
+// Free returns whether tile exists and is not blocked
+func (n *NavGrid) Free(x, y int) bool {
+	return x >= 0 && y >= 0 && x < n.W && y < n.H && n.Cost[y*n.W+x] != 0
+}
+
+// Find searches path from start to goal with A*, crowd returns amount of
+// tanks in tile, it spends Budget and returns false if there is none left,
+// resulting path is smoothed and ends at goal or closest reachable point
+func (n *NavGrid) Find(path []mat.Vec, start, goal mat.Vec, radius float64, crowd func(i int) int) ([]mat.Vec, bool) {
+	if n.Budget <= 0 || len(n.Cost) == 0 {
+		return path, false
+	}
+
+	n.search++
+	s, e := n.Adr(start), n.Adr(goal)
+	si, ei := s.Y*n.W+s.X, e.Y*n.W+e.X
+	n.open = n.open[:0]
+	n.visit(si, -1, 0)
+	heap.Push(&n.open, navNode{si, n.heuristic(s, e)})
+
+	best, bestH := si, n.heuristic(s, e)
+	expanded := 0
+	for len(n.open) != 0 && expanded < MaxExpand {
+		c := heap.Pop(&n.open).(navNode)
+		if n.closed[c.idx] == n.search {
+			continue
+		}
+		n.closed[c.idx] = n.search
+		expanded++
+
+		cp := mat.P(c.idx%n.W, c.idx/n.W)
+		if h := n.heuristic(cp, e); h < bestH {
+			best, bestH = c.idx, h
+		}
+		if c.idx == ei {
+			break
+		}
+
+		for _, d := range navDirs {
+			x, y := cp.X+d.X, cp.Y+d.Y
+			if !n.Free(x, y) {
+				continue
+			}
+			// no cutting corners of blocked tiles
+			if d.X != 0 && d.Y != 0 && (!n.Free(cp.X+d.X, cp.Y) || !n.Free(cp.X, cp.Y+d.Y)) {
+				continue
+			}
+
+			i := y*n.W + x
+			if n.closed[i] == n.search {
+				continue
+			}
+			step := 1.
+			if d.X != 0 && d.Y != 0 {
+				step = math.Sqrt2
+			}
+			g := n.g[c.idx] + step*(n.Cost[i]+CrowdCost*float64(crowd(i)))
+			if n.stamp[i] == n.search && g >= n.g[i] {
+				continue
+			}
+			n.visit(i, c.idx, g)
+			heap.Push(&n.open, navNode{i, g + n.heuristic(mat.P(x, y), e)})
+		}
+	}
+	n.Budget -= expanded
+
+	path = path[:0]
+	for i := best; i != -1 && i != si; i = n.from[i] {
+		path = append(path, n.Center(i%n.W, i/n.W))
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	if best == ei {
+		if len(path) != 0 {
+			path[len(path)-1] = goal
+		} else {
+			path = append(path, goal)
+		}
+	}
+
+	return n.Smooth(path, start, radius), true
+}
+
+// Smooth removes points of path that can be skipped by driving straight
+func (n *NavGrid) Smooth(path []mat.Vec, start mat.Vec, radius float64) []mat.Vec {
+	res := path[:0]
+	from := start
+	for i := 0; i < len(path); i++ {
+		if i+1 < len(path) && n.Clear(from, path[i+1], radius) {
+			continue
+		}
+		res = append(res, path[i])
+		from = path[i]
+	}
+	return res
+}
+
+// Clear returns whether circle can move from a to b without crossing
+// blocked or costly tiles
+func (n *NavGrid) Clear(a, b mat.Vec, radius float64) bool {
+	dir := a.To(b)
+	l := dir.Len()
+	if l == 0 {
+		return true
+	}
+	side := dir.Normal().Scaled(radius / l)
+	step := math.Min(n.Tile.X, n.Tile.Y) / 3
+	for d := 0.; ; d += step {
+		if d > l {
+			d = l
+		}
+		p := a.Add(dir.Scaled(d / l))
+		for _, o := range [...]mat.Vec{p, p.Add(side), p.Sub(side)} {
+			t := n.Adr(o)
+			if c := n.Cost[t.Y*n.W+t.X]; c != 1 {
+				return false
+			}
+		}
+		if d == l {
+			return true
+		}
+	}
+}
+
+func (n *NavGrid) visit(i, from int, g float64) {
+	n.stamp[i] = n.search
+	n.from[i] = from
+	n.g[i] = g
+}
+
+// heuristic is octile distance, it never overestimates as costs are at least 1
+func (n *NavGrid) heuristic(a, b mat.Point) float64 {
+	dx, dy := math.Abs(float64(a.X-b.X)), math.Abs(float64(a.Y-b.Y))
+	return math.Max(dx, dy) + (math.Sqrt2-1)*math.Min(dx, dy)
+}
+
+// Route returns point tank should drive to to reach the target, path is
+// searched again when target moved too far from its goal
+func (w *World) Route(t *Tank, target mat.Vec) mat.Vec {
+	p := &t.Path
+	tile := math.Min(w.Tile.X, w.Tile.Y)
+	if p.Target != t.Target || p.Goal.To(target).Len() > Repath*tile {
+		points, ok := w.Nav.Find(p.Points, t.Pos, target, t.Size, w.Crowd)
+		if ok {
+			p.Points, p.Goal, p.Next, p.Target = points, target, 0, t.Target
+		}
+	}
+
+	for p.Next < len(p.Points) && t.Pos.To(p.Points[p.Next]).Len() < tile/2 {
+		p.Next++
+	}
+	if p.Next < len(p.Points) {
+		return p.Points[p.Next]
+	}
+	return target
+}
+
+// Crowd returns amount of tanks in tile of navigation grid
+func (w *World) Crowd(i int) int {
+	return len(w.Hasher.Nodes[i].Ints)
+}
+
+var navDirs = [...]mat.Point{
+	{X: 1}, {X: -1}, {Y: 1}, {Y: -1},
+	{X: 1, Y: 1}, {X: 1, Y: -1}, {X: -1, Y: 1}, {X: -1, Y: -1},
+}
+
+type navNode struct {
+	idx int
+	f   float64
+}
+
+type navHeap []navNode
+
+func (h navHeap) Len() int            { return len(h) }
+func (h navHeap) Less(i, j int) bool  { return h[i].f < h[j].f }
+func (h navHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *navHeap) Push(x interface{}) { *h = append(*h, x.(navNode)) }
+func (h *navHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
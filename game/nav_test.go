@@ -0,0 +1,302 @@
+package game
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// navGrid creates grid from rows, '#' is blocked tile, '.' costs 1 and
+// digit is cost of tile
+func navGrid(rows ...string) *NavGrid {
+	n := &NavGrid{W: len(rows[0]), H: len(rows), Tile: mat.V(10, 10), Budget: PathBudget}
+	n.Cost = make([]float64, n.W*n.H)
+	n.g = make([]float64, len(n.Cost))
+	n.from = make([]int, len(n.Cost))
+	n.stamp = make([]uint32, len(n.Cost))
+	n.closed = make([]uint32, len(n.Cost))
+	for y, row := range rows {
+		for x, c := range row {
+			switch {
+			case c == '.':
+				n.Cost[y*n.W+x] = 1
+			case c >= '1' && c <= '9':
+				n.Cost[y*n.W+x] = float64(c - '0')
+			}
+		}
+	}
+	return n
+}
+
+func noCrowd(int) int { return 0 }
+
+// touches returns whether segment goes trough tile of given cost
+func touches(n *NavGrid, a, b mat.Vec, cost float64) bool {
+	for f := 0.; f <= 1; f += .01 {
+		p := n.Adr(a.Add(a.To(b).Scaled(f)))
+		if n.Cost[p.Y*n.W+p.X] == cost {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNavFind(t *testing.T) {
+	cases := []struct {
+		desc        string
+		rows        []string
+		start, goal mat.Point
+		crowd       func(int) int
+		// reach is whether path ends at goal, points is expected amount of
+		// points after smoothing, -1 when it does not matter
+		reach  bool
+		points int
+		// avoid is cost of tiles path must not cross
+		avoid float64
+	}{
+		{
+			desc:  "open",
+			rows:  []string{".....", ".....", "....."},
+			start: mat.P(0, 0), goal: mat.P(4, 2),
+			reach: true, points: 1,
+		},
+		{
+			desc: "around wall",
+			rows: []string{
+				".......",
+				".......",
+				"...#...",
+				"...#...",
+				"...#...",
+			},
+			start: mat.P(1, 4), goal: mat.P(5, 4),
+			reach: true, points: -1, avoid: 0,
+		},
+		{
+			desc: "unreachable",
+			rows: []string{
+				".....",
+				".###.",
+				".#.#.",
+				".###.",
+				".....",
+			},
+			start: mat.P(0, 0), goal: mat.P(2, 2),
+			reach: false, points: -1, avoid: 0,
+		},
+		{
+			desc: "weighted",
+			rows: []string{
+				".....",
+				".999.",
+				".....",
+			},
+			start: mat.P(0, 1), goal: mat.P(4, 1),
+			reach: true, points: -1, avoid: 9,
+		},
+		{
+			desc: "weighted wall",
+			rows: []string{
+				"..2..",
+				"..2..",
+				"..2..",
+			},
+			start: mat.P(0, 1), goal: mat.P(4, 1),
+			reach: true, points: -1, avoid: 0,
+		},
+		{
+			desc: "crowded",
+			rows: []string{
+				".....",
+				".....",
+				".....",
+			},
+			start: mat.P(0, 1), goal: mat.P(4, 1),
+			crowd: func(i int) int {
+				if i/5 == 1 && i%5 > 0 && i%5 < 4 {
+					return 10
+				}
+				return 0
+			},
+			reach: true, points: -1, avoid: 0,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			n := navGrid(c.rows...)
+			crowd := c.crowd
+			if crowd == nil {
+				crowd = noCrowd
+			}
+			start, goal := n.Center(c.start.X, c.start.Y), n.Center(c.goal.X, c.goal.Y)
+			path, ok := n.Find(nil, start, goal, 0, crowd)
+			if !ok || len(path) == 0 {
+				t.Fatalf("no path found: %v", path)
+			}
+			if c.points != -1 && len(path) != c.points {
+				t.Errorf("expected %d points, got %v", c.points, path)
+			}
+			if end := path[len(path)-1]; (end == goal) != c.reach {
+				t.Errorf("path ends at %v, goal is %v", end, goal)
+			}
+
+			from := start
+			for _, p := range path {
+				if touches(n, from, p, c.avoid) {
+					t.Errorf("path %v crosses tiles of cost %g", path, c.avoid)
+				}
+				from = p
+			}
+			if c.crowd != nil {
+				for _, p := range path {
+					a := n.Adr(p)
+					if c.crowd(a.Y*n.W+a.X) != 0 {
+						t.Errorf("path %v goes trough crowded tile", path)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNavFindClosest(t *testing.T) {
+	n := navGrid(
+		".....",
+		".###.",
+		".#.#.",
+		".###.",
+		".....",
+	)
+	goal := n.Center(2, 2)
+	path, _ := n.Find(nil, n.Center(0, 0), goal, 0, noCrowd)
+	end := n.Adr(path[len(path)-1])
+	if h := n.heuristic(end, mat.P(2, 2)); h != 2 {
+		t.Fatalf("path ends at %v, not at tile closest to goal", end)
+	}
+}
+
+func TestNavSmooth(t *testing.T) {
+	n := navGrid(
+		".....",
+		".....",
+		"..#..",
+		".....",
+	)
+	c := n.Center
+	cases := []struct {
+		desc     string
+		start    mat.Vec
+		path     []mat.Vec
+		radius   float64
+		expected []mat.Vec
+	}{
+		{"empty", c(0, 0), nil, 0, nil},
+		{"straight", c(0, 0), []mat.Vec{c(1, 0), c(2, 0), c(3, 0)}, 0, []mat.Vec{c(3, 0)}},
+		{"diagonal", c(0, 0), []mat.Vec{c(1, 0), c(1, 1), c(2, 1), c(3, 1)}, 0, []mat.Vec{c(3, 1)}},
+		{"around block", c(1, 3), []mat.Vec{c(1, 2), c(1, 1), c(2, 1), c(3, 1), c(3, 2), c(3, 3)}, 0, []mat.Vec{c(1, 1), c(3, 1), c(3, 3)}},
+		{"wide", c(0, 1), []mat.Vec{c(1, 1), c(2, 1), c(3, 1), c(4, 1)}, 4, []mat.Vec{c(4, 1)}},
+		{"too wide", c(0, 1), []mat.Vec{c(1, 1), c(2, 1), c(3, 1), c(4, 1)}, 6, []mat.Vec{c(1, 1), c(2, 1), c(3, 1), c(4, 1)}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.desc, func(t *testing.T) {
+			path := n.Smooth(append([]mat.Vec(nil), cs.path...), cs.start, cs.radius)
+			if len(path) != len(cs.expected) {
+				t.Fatalf("expected %v, got %v", cs.expected, path)
+			}
+			for i := range path {
+				if path[i] != cs.expected[i] {
+					t.Fatalf("expected %v, got %v", cs.expected, path)
+				}
+			}
+		})
+	}
+}
+
+func TestNavBudget(t *testing.T) {
+	// goal is walled off so search expands as much as it can
+	rows := make([]string, 60)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", 60)
+	}
+	rows[57] = strings.Repeat(".", 57) + "###"
+	rows[58] = strings.Repeat(".", 57) + "#.#"
+	rows[59] = strings.Repeat(".", 57) + "#.#"
+	n := navGrid(rows...)
+	goal := n.Center(58, 59)
+
+	path, ok := n.Find(nil, n.Center(0, 0), goal, 0, noCrowd)
+	if !ok || len(path) == 0 || path[len(path)-1] == goal {
+		t.Fatalf("expected path to closest tile, got %v %v", path, ok)
+	}
+	if n.Budget != PathBudget-MaxExpand {
+		t.Fatalf("search spent %d tiles, expected %d", PathBudget-n.Budget, MaxExpand)
+	}
+
+	n.Budget = 1
+	if _, ok := n.Find(nil, n.Center(0, 0), goal, 0, noCrowd); !ok || n.Budget > 0 {
+		t.Fatalf("search with budget left did not run or spend it")
+	}
+
+	old := []mat.Vec{mat.V(1, 2)}
+	if path, ok := n.Find(old, n.Center(0, 0), n.Center(1, 0), 0, noCrowd); ok || len(path) != 1 || path[0] != old[0] {
+		t.Fatalf("search without budget changed path to %v", path)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	w := testWorld(t, "medium", 1)
+	tk := w.Tanks.Item(w.Player)
+	tile := w.Tile.X
+	tk.Target = -1
+	tk.Path.Reset()
+
+	target := tk.Pos.Add(mat.V(tile*10, 0))
+	w.Nav.Budget = PathBudget
+	next := w.Route(tk, target)
+	if len(tk.Path.Points) == 0 || tk.Path.Goal != target {
+		t.Fatalf("path was not found: %+v", tk.Path)
+	}
+	if next != tk.Path.Points[0] {
+		t.Fatalf("route leads to %v instead of first point %v", next, tk.Path.Points[0])
+	}
+
+	// small move of target keeps the path
+	points := append([]mat.Vec(nil), tk.Path.Points...)
+	w.Nav.Budget = PathBudget
+	w.Route(tk, target.Add(mat.V(tile*Repath/2, 0)))
+	if tk.Path.Goal != target {
+		t.Fatal("path was searched again for small move of target")
+	}
+
+	// no budget keeps the old path even if target moved far
+	w.Nav.Budget = 0
+	far := target.Add(mat.V(0, tile*5))
+	w.Route(tk, far)
+	if tk.Path.Goal != target || len(tk.Path.Points) != len(points) {
+		t.Fatal("path changed without budget")
+	}
+
+	w.Nav.Budget = PathBudget
+	w.Route(tk, far)
+	if tk.Path.Goal != far {
+		t.Fatal("path was not searched again for far target")
+	}
+
+	// reaching a point moves to the next one
+	tk.Pos = tk.Path.Points[0]
+	if next := w.Route(tk, far); len(tk.Path.Points) > 1 && next != tk.Path.Points[1] || tk.Path.Next != 1 {
+		t.Fatalf("route did not advance past reached point, next is %d", tk.Path.Next)
+	}
+}
+
+func TestCrowd(t *testing.T) {
+	w := testWorld(t, "medium", 1)
+	tk := w.Tanks.Item(w.Player)
+	a := w.Nav.Adr(tk.Pos)
+	if w.Crowd(a.Y*w.Nav.W+a.X) == 0 {
+		t.Fatal("tile of player tank is not crowded")
+	}
+}
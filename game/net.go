@@ -2,29 +2,688 @@ package game
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/logic/timer"
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// network properties
+const (
+	DefaultPort    = 7777
+	WriteTimeout   = time.Second
+	SnapshotPeriod = 3
+	// StateHistory is amount of past snapshots server keeps for each client to
+	// compute deltas against, client that acknowledged older one gets full
+	// snapshot
+	StateHistory = 64
+	RespawnTime  = 3.
+	// InputBuffer is maximal amount of inputs server keeps for client, client
+	// sending faster then server simulates looses the oldest ones and each
+	// lost one counts as violation
+	InputBuffer = 8
 )
 
+// Lag makes connection behave like a bad network, messages are delayed by
+// Latency plus random Jitter and Loss is chance that message which would not
+// matter on unreliable transport gets dropped, order of messages is kept
+type Lag struct {
+	Latency, Jitter time.Duration
+	Loss            float64
+	// Clock drives the delays, nil means real time
+	Clock Clock
+}
+
+// Clock is source of time for Lag
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is real time
+type SystemClock struct{}
+
+// Now implements Clock interface
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep implements Clock interface
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// FakeClock moves only when advanced, it makes delayed connection
+// deterministic in one process
+type FakeClock struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	now  time.Time
+}
+
+// NFakeClock creates clock starting at start
+func NFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements Clock interface
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep blocks until clock is advanced by d
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for c.now.Before(end) {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+}
+
+// Advance moves the clock and wakes sleepers whose time came
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+func (l *Lag) clock() Clock {
+	if l.Clock == nil {
+		return SystemClock{}
+	}
+	return l.Clock
+}
+
+// Delay returns random delay of message
+func (l *Lag) Delay() time.Duration {
+	d := l.Latency
+	if l.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(l.Jitter)))
+	}
+	return d
+}
+
+// Drop returns whether message should be lost
+func (l *Lag) Drop(data []byte) bool {
+	return !Reliable(Kind(data)) && rand.Float64() < l.Loss
+}
+
+// Kind returns kind of message in data
+func Kind(data []byte) Message {
+	if len(data) < 2 {
+		return 0
+	}
+	return Message(data[0]) | Message(data[1])<<8
+}
+
+// Reliable returns whether message has to arrive, inputs and snapshots are
+// sent every tick so lost one is quickly replaced
+func Reliable(m Message) bool {
+	return m != InputFrame && m != Snapshot
+}
+
+// Net sends and receives messages over connection of any transport, messages
+// are read on separate goroutine and handed over through Inbox so the world
+// is only ever touched from its own goroutine
 type Net struct {
+	Conn  Conn
+	Inbox <-chan netw.Buffer
+
+	buff netw.Buffer
 }
 
+// NNet wraps connection
+func NNet(conn Conn) *Net {
+	return &Net{
+		Conn:  conn,
+		Inbox: conn.Inbox(),
+	}
+}
+
+// Err is the reason connection ended, it is valid once Inbox is closed
+func (n *Net) Err() error {
+	return n.Conn.Err()
+}
+
+// Message returns cleared buffer with message kind already written
+func (n *Net) Message(m Message) *netw.Buffer {
+	n.buff.Clear()
+	n.buff.PutUint16(uint16(m))
+	return &n.buff
+}
+
+// Send sends buffer, whether message is reliable depends on its kind
+func (n *Net) Send(b *netw.Buffer) {
+	n.Conn.Send(b.Data, Reliable(Kind(b.Data)))
+}
+
+// Close closes the connection
+func (n *Net) Close() {
+	n.Conn.Close()
+}
+
+// Session is connection of one client to server
+type Session struct {
+	*Net
+	ID   int
+	Name string
+	// Tank is id of tank controlled by client, it is only hint, tank with the
+	// id may already belong to someone else
+	Tank    int
+	Respawn timer.Timer
+	// Seq is sequence of last applied input, Acked is tick of last snapshot
+	// client received
+	Seq, Acked int
+	// Inputs are received inputs waiting to be applied, one each tick
+	Inputs []InputMessage
+	// View is tick of world client saw when it sent last applied input
+	View int
+	// Eye and Sight are center and half size of client camera
+	Eye, Sight mat.Vec
+	// History are states sent to client, each client sees different part
+	// of the world
+	History []*WorldState
+	// Admin can run console commands, Kicked is reason to disconnect client
+	// before next tick
+	Admin  bool
+	Kicked error
+	// ChatTokens is how many messages client can send now, it refills since
+	// ChatTime
+	ChatTokens float64
+	ChatTime   time.Time
+	// Violations is amount of invalid inputs client sent, Logins is amount
+	// of wrong passwords
+	Violations int
+	Logins     int
+	// Shooting is whether last applied input held Shoot, Clicks is how
+	// many recent clicks count against MaxClicks
+	Shooting bool
+	Clicks   float64
+}
+
+// Server is authoritative multiplayer server, clients only send their inputs and
+// server simulates the world and sends them snapshots
 type Server struct {
-	Listener    *net.TCPListener
+	Transport   Transport
+	Listener    Listener
 	AcceptError error
+	// Beacon announces the server on local network, it is nil if socket
+	// could not be opened
+	Beacon *Beacon
+	Name   string
+	// MaxPlayers is maximal amount of connected clients, zero means no limit
+	MaxPlayers int
+	// Password lets clients run console commands, empty disables that
+	Password string
+	// MaxViolations is amount of invalid inputs client gets kicked after,
+	// zero disables kicking
+	MaxViolations int
+	// Bans are refused addresses
+	Bans map[string]bool
+	// Restart makes server start the match again at the end of tick
+	Restart bool
+	Rewind  Rewind
+	// Bullets hashes bullets of last snapshot for Interest
+	Bullets BulletHash
+
+	Joining  chan *Net
+	Sessions []*Session
+	Counter  int
+
+	Lobby  *Lobby
+	Spawns []SpawnMessage
+	Deaths []DeathMessage
+	Chats  []ChatMessage
 }
 
-func NServer(port int) (s *Server, err error) {
-	s = &Server{}
+// NServer starts listening on port of transport and accepting connections,
+// port 0 picks random free port
+func NServer(t Transport, port int) (s *Server, err error) {
+	s = &Server{
+		Transport:     t,
+		Joining:       make(chan *Net, 16),
+		MaxViolations: DefaultViolations,
+		Lobby:         &Lobby{},
+		Bans:          map[string]bool{},
+	}
+	s.Rewind.Clear()
 
-	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%d", port))
+	s.Listener, err = t.Listen(port)
 	if err != nil {
 		return
 	}
 
-	s.Listener, err = net.ListenTCP("tcp", addr)
-	if err != nil {
-		return
+	s.Name = HostName()
+	if b, err := NBeacon(); err != nil {
+		fmt.Println("server will not be announced:", err)
+	} else {
+		s.Beacon = b
+	}
+
+	go s.accept()
+
+	return
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			s.AcceptError = err
+			close(s.Joining)
+			return
+		}
+		s.Joining <- NNet(conn)
 	}
+}
 
+// Players returns amount of clients that finished handshake
+func (s *Server) Players() (n int) {
+	for _, ss := range s.Sessions {
+		if ss.Name != "" {
+			n++
+		}
+	}
 	return
 }
+
+// Port returns port server listens on
+func (s *Server) Port() int {
+	return s.Listener.Port()
+}
+
+// Close stops accepting and disconnects all clients
+func (s *Server) Close() {
+	for _, ss := range s.Sessions {
+		ss.Close()
+	}
+	s.Sessions = nil
+	s.Listener.Close()
+	if s.Beacon != nil {
+		s.Beacon.Close()
+	}
+}
+
+// Base returns snapshot sent to client with given tick or nil
+func (ss *Session) Base(tick int) *WorldState {
+	for _, st := range ss.History {
+		if st.Tick == tick {
+			return st
+		}
+	}
+	return nil
+}
+
+// StopServer disconnects all clients and stops the server
+func (w *World) StopServer() {
+	if w.Server == nil {
+		return
+	}
+
+	for _, ss := range w.Server.Sessions {
+		w.Disconnect(ss)
+	}
+	w.Server.Close()
+	w.Server = nil
+	w.Chat.Reset()
+}
+
+// Receive accepts new clients and processes messages of connected ones, it is
+// called at the start of each tick
+func (w *World) Receive() {
+	s := w.Server
+	w.Announce()
+
+	for accepting := true; accepting; {
+		select {
+		case n, ok := <-s.Joining:
+			if !ok {
+				w.Event("accept_failed", "error", s.AcceptError)
+				s.Joining = nil
+				accepting = false
+				continue
+			}
+			if host, _, _ := net.SplitHostPort(n.Conn.RemoteAddr().String()); s.Bans[host] {
+				r := n.Message(Reject)
+				r.PutUint16(NetVersion)
+				r.PutString("you are banned")
+				n.Send(r)
+				n.Close()
+				w.Event("refused", "address", host)
+				continue
+			}
+			s.Counter++
+			s.Sessions = append(s.Sessions, &Session{
+				Net:   n,
+				ID:    s.Counter,
+				Tank:  -1,
+				Acked: -1,
+			})
+		default:
+			accepting = false
+		}
+	}
+
+	for i := 0; i < len(s.Sessions); i++ {
+		ss := s.Sessions[i]
+		if err := w.Poll(ss); err != nil {
+			w.Event("leave", "client", ss.ID, "name", ss.Name, "reason", err)
+			w.Disconnect(ss)
+			s.Lobby.Remove(ss.ID)
+			s.Sessions = append(s.Sessions[:i], s.Sessions[i+1:]...)
+			i--
+			continue
+		}
+
+		if ss.Name == "" || w.GameState != MultiplayerServer {
+			continue
+		}
+
+		if len(ss.Inputs) != 0 {
+			in := ss.Inputs[0]
+			ss.Inputs = append(ss.Inputs[:0], ss.Inputs[1:]...)
+			t := w.SessionTank(ss)
+			if in.Seq <= ss.Seq {
+				// replayed input would move the tank twice
+				w.Violation(ss, "sequence")
+			} else {
+				if v := w.Validate(ss, &in, t); v != "" {
+					w.Violation(ss, v)
+				}
+				ss.Seq = in.Seq
+				ss.View = in.View
+				ss.Eye, ss.Sight = in.Eye, in.Sight
+				if t != nil {
+					copy(t.Input, in.Input)
+					t.Aim = in.Aim
+				}
+			}
+		}
+
+		if t := w.SessionTank(ss); t == nil && ss.Respawn.TickDone(w.Delta) {
+			w.SpawnChoice(ss.ID)
+			ss.Respawn = timer.Period(RespawnTime)
+		}
+	}
+}
+
+// Poll processes all messages session received since last tick, error means
+// client has to be disconnected
+func (w *World) Poll(ss *Session) (err error) {
+	defer func() {
+		// binding.S panics on length mismatch
+		if rec := recover(); rec != nil {
+			err = ErrNetCorrupt.Wrap(fmt.Errorf("%v", rec))
+		}
+	}()
+
+	for {
+		select {
+		case b, ok := <-ss.Inbox:
+			if !ok {
+				return ss.Err()
+			}
+			err = w.Handle(ss, &b)
+			if err != nil {
+				return err
+			}
+		default:
+			return ss.Kicked
+		}
+	}
+}
+
+// Handle processes one message from client
+func (w *World) Handle(ss *Session, b *netw.Buffer) error {
+	m := Message(b.Uint16())
+	if ss.Name == "" && m != Hello {
+		return ErrNetMessage.Args(m)
+	}
+
+	switch m {
+	case Hello:
+		if ss.Name != "" {
+			// joined client would be added to lobby again
+			w.Violation(ss, "hello")
+			return nil
+		}
+		if v := b.Uint16(); v != NetVersion {
+			r := ss.Message(Reject)
+			r.PutUint16(NetVersion)
+			r.PutString(fmt.Sprintf("server runs protocol version %d", NetVersion))
+			ss.Send(r)
+			return ErrNetVersion.Args(v, NetVersion)
+		}
+		if max := w.Server.MaxPlayers; max != 0 && w.Server.Players() >= max {
+			r := ss.Message(Reject)
+			r.PutUint16(NetVersion)
+			r.PutString("server is full")
+			ss.Send(r)
+			return ErrNetFull
+		}
+		ss.Name = CleanName(b.String())
+		if h := b.Uint64(); h != w.Stats.Hash() && !b.Failed {
+			r := ss.Message(Mismatch)
+			putSources(r, w.StatSources)
+			ss.Send(r)
+			return ErrNetForeign
+		}
+		if ss.Name == "" {
+			ss.Name = fmt.Sprintf("player%d", ss.ID)
+		}
+
+		r := ss.Message(Welcome)
+		r.PutUint16(NetVersion)
+		r.PutUint32(uint32(ss.ID))
+		r.PutUint16(uint16(math.Round(1 / w.Step)))
+		ss.Send(r)
+		w.Event("join", "client", ss.ID, "name", ss.Name)
+
+		l := w.Server.Lobby
+		l.Players = append(l.Players, LobbyPlayer{ID: ss.ID, Name: ss.Name})
+		w.FixChoice(l, &l.Players[len(l.Players)-1])
+		l.Dirty = true
+		if w.GameState == MultiplayerServer {
+			w.SendStart(ss)
+		}
+	case Command:
+		line := b.String()
+		if b.Failed {
+			return ErrNetCorrupt
+		}
+		r := ss.Message(Command)
+		r.PutString(w.Remote(ss, line))
+		ss.Send(r)
+	case LobbyChoice:
+		var p LobbyPlayer
+		p.Read(b)
+		l := w.Server.Lobby
+		if lp := l.Player(ss.ID); lp != nil && !b.Failed {
+			lp.Team, lp.Tank, lp.Ready = p.Team, p.Tank, p.Ready
+			w.FixChoice(l, lp)
+			l.Dirty = true
+		}
+	case InputFrame:
+		var in InputMessage
+		in.Read(b)
+		if b.Failed {
+			return ErrNetCorrupt
+		}
+		ss.Acked = in.Acked
+		if w.GameState != MultiplayerServer {
+			// late inputs of finished match
+			break
+		}
+		if len(ss.Inputs) == InputBuffer {
+			ss.Inputs = append(ss.Inputs[:0], ss.Inputs[1:]...)
+			w.Violation(ss, "input_rate")
+		}
+		ss.Inputs = append(ss.Inputs, in)
+	case Chat:
+		var c ChatMessage
+		c.Read(b)
+		if b.Failed {
+			return ErrNetCorrupt
+		}
+		if !ss.AllowChat(time.Now()) {
+			r := ss.Message(Command)
+			r.PutString("you are sending messages too fast")
+			ss.Send(r)
+			break
+		}
+		if c.Text = CleanChat(c.Text); c.Text != "" {
+			c.From, c.Sender = ss.Name, ss.ID
+			w.Server.Chats = append(w.Server.Chats, c)
+		}
+	default:
+		return ErrNetMessage.Args(m)
+	}
+
+	if b.Failed {
+		return ErrNetCorrupt
+	}
+
+	return nil
+}
+
+// SessionTank returns tank controlled by session or nil if it has none
+func (w *World) SessionTank(ss *Session) *Tank {
+	// storage shrinks when match restarts
+	if ss.Tank != -1 && ss.Tank < w.Tanks.Len() && w.Tanks.Used(ss.Tank) {
+		if t := w.Tanks.Item(ss.Tank); t.Client == ss.ID && !t.Dead() {
+			return t
+		}
+	}
+
+	// tank could have leveled up
+	ss.Tank = -1
+	for _, id := range w.Tanks.Occupied() {
+		if t := w.Tanks.Item(id); t.Client == ss.ID && !t.Dead() {
+			ss.Tank = id
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Disconnect closes the session and removes its tank
+func (w *World) Disconnect(ss *Session) {
+	ss.Close()
+	if t := w.SessionTank(ss); t != nil {
+		t.Health = 0
+	}
+}
+
+// Broadcast sends events of this tick to all clients and snapshot if its time,
+// it is called at the end of each tick
+func (w *World) Broadcast() {
+	s := w.Server
+	s.Rewind.Record(w)
+	w.SendEvents()
+
+	if w.Ticks%SnapshotPeriod != 0 {
+		return
+	}
+
+	state := w.State()
+	for _, ss := range s.Sessions {
+		if ss.Name == "" {
+			continue
+		}
+
+		base := ss.Base(ss.Acked)
+		own := w.Interest(ss, state, base)
+		b := ss.Message(Snapshot)
+		b.PutUint32(uint32(state.Tick))
+		b.PutUint32(uint32(ss.Seq))
+		if base == nil {
+			b.PutInt32(-1)
+		} else {
+			b.PutInt32(int32(base.Tick))
+		}
+		WriteDelta(b, base, own)
+		ss.Send(b)
+
+		if len(ss.History) == StateHistory {
+			ss.History = append(ss.History[:0], ss.History[1:]...)
+		}
+		ss.History = append(ss.History, own)
+	}
+}
+
+// SendEvents sends queued events to all clients
+func (w *World) SendEvents() {
+	s := w.Server
+
+	for _, ss := range s.Sessions {
+		if ss.Name == "" {
+			continue
+		}
+
+		for i := range s.Spawns {
+			b := ss.Message(SpawnEvent)
+			s.Spawns[i].Write(b)
+			ss.Send(b)
+		}
+		for i := range s.Deaths {
+			b := ss.Message(DeathEvent)
+			s.Deaths[i].Write(b)
+			ss.Send(b)
+		}
+		for i := range s.Chats {
+			if !s.Hears(ss.ID, &s.Chats[i]) {
+				continue
+			}
+			b := ss.Message(Chat)
+			s.Chats[i].Write(b)
+			ss.Send(b)
+		}
+	}
+
+	for i := range s.Chats {
+		m := &s.Chats[i]
+		w.Event("chat", "client", m.Sender, "name", m.From, "team", m.Team, "text", m.Text)
+		if !w.Headless && s.Hears(0, m) {
+			w.Chat.Add(*m)
+		}
+	}
+	s.Spawns = s.Spawns[:0]
+	s.Deaths = s.Deaths[:0]
+	s.Chats = s.Chats[:0]
+}
+
+// Event logs server event as key=value pairs to EventLog, kv alternates keys
+// and values
+func (w *World) Event(event string, kv ...interface{}) {
+	if w.EventLog == nil {
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "time=%s event=%s", time.Now().Format(time.RFC3339), event)
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := fmt.Sprint(kv[i+1])
+		if v == "" || strings.ContainsAny(v, " =\"\n") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&sb, " %v=%s", kv[i], v)
+	}
+	sb.WriteByte('\n')
+
+	io.WriteString(w.EventLog, sb.String())
+}
@@ -0,0 +1,240 @@
+package game
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// host starts headless server of world listening on random port
+func host(t *testing.T, tr Transport, world string) *World {
+	t.Helper()
+	a := loadAssets(t)
+	wd, _, ok := a.Worlds.World(world)
+	if !ok {
+		t.Fatalf("world %q is missing", world)
+	}
+
+	w := NHeadlessWorld(a)
+	w.EventLog = nil
+	if err := w.Host(wd, tr, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.StopServer)
+	return w
+}
+
+// address returns loopback address of server
+func address(s *World) string {
+	return JoinScheme(s.Server.Transport, "127.0.0.1:"+strconv.Itoa(s.Server.Port()))
+}
+
+// join connects headless client to server, server keeps being served while
+// client waits for Welcome
+func join(t *testing.T, s *World, name string) *World {
+	t.Helper()
+	return connect(t, s, address(s), name)
+}
+
+// connect is join with explicit address
+func connect(t *testing.T, s *World, addr, name string) *World {
+	t.Helper()
+	c := NHeadlessWorld(s.Assets)
+	c.EventLog = nil
+
+	done := make(chan error, 1)
+	go func() { done <- c.Connect(addr, name) }()
+
+	deadline := time.Now().Add(ConnectTimeout)
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(c.StopClient)
+			return c
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client did not connect")
+		}
+		s.Serve(s.Step)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// until serves server and syncs clients until cond holds
+func until(t *testing.T, s *World, cond func() bool, clients ...*World) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		s.Serve(s.Step)
+		for _, c := range clients {
+			if err := c.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// start readies all clients and waits until they control their tanks
+func start(t *testing.T, s *World, clients ...*World) {
+	t.Helper()
+	until(t, s, func() bool {
+		for _, c := range clients {
+			if c.Client.Lobby == nil || len(c.Client.Lobby.Players) != len(clients) {
+				return false
+			}
+		}
+		return true
+	}, clients...)
+
+	for _, c := range clients {
+		c.ToggleReady()
+	}
+	until(t, s, func() bool {
+		for _, c := range clients {
+			if c.GameState != MultiplayerClient || c.Player == -1 {
+				return false
+			}
+		}
+		return s.GameState == MultiplayerServer
+	}, clients...)
+}
+
+// sendInput sends one input of client, sight covers whole map
+func sendInput(c *World, seq int, input binding.S) {
+	in := InputMessage{
+		Seq:   seq,
+		Acked: c.Client.Acked,
+		View:  c.Client.Acked,
+		Input: input,
+		Eye:   c.Size.Scaled(.5),
+		Sight: c.Size.Scaled(.5),
+	}
+	b := c.Client.Message(InputFrame)
+	in.Write(b)
+	c.Client.Send(b)
+}
+
+func TestServerLoopback(t *testing.T) {
+	for name, tr := range Transports {
+		t.Run(name, func(t *testing.T) {
+			s := host(t, tr, "hard")
+			c := join(t, s, "tester")
+			if s.Server.Players() != 1 {
+				t.Fatalf("expected one player, got %d", s.Server.Players())
+			}
+
+			start(t, s, c)
+
+			ss := s.Server.Sessions[0]
+			tank := s.SessionTank(ss)
+			if tank == nil || !tank.Player || tank.Client != ss.ID {
+				t.Fatal("client has no tank on server")
+			}
+			from, dir := tank.Pos, tank.BaseRot
+
+			forward := Bindings.Clone()
+			forward[Forward].State = binding.Pressed
+			for i := 1; i <= 30; i++ {
+				sendInput(c, i, forward)
+				until(t, s, func() bool { return ss.Seq == i }, c)
+			}
+
+			if tank = s.SessionTank(ss); tank == nil {
+				t.Fatal("tank of client was destroyed")
+			}
+			moved := from.To(tank.Pos)
+			if moved.Len() == 0 || moved.Dot(mat.Rad(dir, 1)) <= 0 {
+				t.Fatalf("tank did not drive forward, moved by %v", moved)
+			}
+			if ss.Violations != 0 {
+				t.Fatalf("valid inputs counted as %d violations", ss.Violations)
+			}
+
+			c.StopClient()
+			until(t, s, func() bool { return s.GameState == InLobby && len(s.Server.Sessions) == 0 })
+			if s.SessionTank(ss) != nil {
+				t.Fatal("tank of disconnected client stayed in the world")
+			}
+		})
+	}
+}
+
+func TestDiscoveredClientConverges(t *testing.T) {
+	for name, tr := range Transports {
+		t.Run(name, func(t *testing.T) {
+			s := host(t, tr, "hard")
+			if s.Server.Beacon == nil {
+				t.Skip("announcing socket is not available")
+			}
+
+			d, err := NDiscovery(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			port := d.Conn.LocalAddr().(*net.UDPAddr).Port
+			s.Server.Beacon.Targets = []*net.UDPAddr{{IP: net.IPv4(127, 0, 0, 1), Port: port}}
+
+			until(t, s, func() bool {
+				d.Update()
+				return len(d.Games) != 0
+			})
+			g := d.Games[0]
+			if g.Name != s.Server.Name || g.Map != "hard" || g.Transport != tr.Name() {
+				t.Fatalf("unexpected announcement %+v", g)
+			}
+
+			c := connect(t, s, g.Addr, "tester")
+			start(t, s, c)
+			if half := c.Size.Scaled(.5); half.X > MaxSight || half.Y > MaxSight {
+				t.Fatal("map does not fit into sight, client cannot see everything")
+			}
+
+			// client sends idle inputs and must end up seeing what server
+			// simulated at the tick of each snapshot
+			states := map[int]*WorldState{}
+			compared, busy := 0, false
+			deadline := time.Now().Add(30 * time.Second)
+			for seq := 1; compared < 20 || !busy; seq++ {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d snapshots compared up to tick %d, match is too empty to test convergence", compared, c.Ticks)
+				}
+				sendInput(c, seq, Bindings)
+				s.Serve(s.Step)
+				states[s.Ticks] = s.State()
+
+				tick := c.Ticks
+				if err := c.Sync(); err != nil {
+					t.Fatal(err)
+				}
+				if c.Ticks == tick {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+
+				expected := states[c.Ticks]
+				if expected == nil {
+					t.Fatalf("client is at tick %d server never simulated", c.Ticks)
+				}
+				if got := c.State(); !reflect.DeepEqual(got, expected) {
+					t.Fatalf("client diverged at tick %d:\n%+v\n%+v", c.Ticks, got, expected)
+				}
+				compared++
+				busy = busy || len(expected.Tanks) >= 3 && len(expected.Bullets) != 0
+			}
+		})
+	}
+}
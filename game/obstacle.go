@@ -0,0 +1,114 @@
+package game
+
+import (
+	"github.com/jakubDoka/mlok/logic/spatial"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/mlok/mat/rgba"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// BuildStatic inserts obstacles of loaded world into Static, ids in the tree
+// are indexes to Obstacles
+func (w *World) BuildStatic() {
+	bounds := w.Size.ToAABB()
+	for _, o := range w.Obstacles {
+		bounds = bounds.Union(o.Bounds)
+	}
+
+	w.Static = spatial.QuadTree{Bounds: bounds, NodeCap: 8, DepthCap: 6}
+	for i, o := range w.Obstacles {
+		var address int
+		w.Static.Insert(&address, o.Bounds, i, 0)
+	}
+}
+
+// QueryStatic returns ids of obstacles whose bounds intersect the area, result
+// is valid until next call
+func (w *World) QueryStatic(area mat.AABB) []int {
+	b := &w.StaticBuff
+	b[0], b[1], b[2] = w.Static.Query(0, true, area, b[0], b[1], b[2])
+	return b[0]
+}
+
+// CollideTank pushes tank out of obstacles and cancels velocity going into
+// them
+func (w *World) CollideTank(t *Tank) {
+	for _, id := range w.QueryStatic(mat.Square(t.Pos, t.Size)) {
+		push, ok := Push(&w.Obstacles[id], t.Pos, t.Size)
+		if !ok {
+			continue
+		}
+
+		t.Pos.AddE(push)
+		n := push.Normalized()
+		if d := t.Vel.Dot(n); d < 0 {
+			t.Vel.SubE(n.Scaled(d))
+		}
+	}
+}
+
+// Blocked returns whether circle overlaps any obstacle
+func (w *World) Blocked(pos mat.Vec, radius float64) bool {
+	for _, id := range w.QueryStatic(mat.Square(pos, radius)) {
+		if _, ok := Push(&w.Obstacles[id], pos, radius); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DrawObstacles draws obstacles visible in Frame, sprite is stretched over
+// obstacle bounds
+func (w *World) DrawObstacles() {
+	for _, id := range w.QueryStatic(w.Frame) {
+		o := &w.Obstacles[id]
+		scale := o.Bounds.Size().Div(o.Sprite.Frame().Size())
+		o.Sprite.Draw(&w.Batch, mat.M(o.Bounds.Center(), scale, 0), rgba.White)
+	}
+}
+
+// Push returns vector that moves circle out of obstacle and whether they
+// overlap at all
+func Push(o *assets.Obstacle, pos mat.Vec, radius float64) (mat.Vec, bool) {
+	if o.Shape == assets.Circle {
+		d := o.Center.To(pos)
+		l, r := d.Len(), o.Radius+radius
+		if l >= r {
+			return mat.ZV, false
+		}
+		if l == 0 {
+			return mat.V(r, 0), true
+		}
+		return d.Scaled((r - l) / l), true
+	}
+
+	inside := true
+	var closest mat.Vec
+	best := -1.
+	for i, a := range o.Points {
+		e := a.To(o.Points[(i+1)%len(o.Points)])
+		ap := a.To(pos)
+		if e.Cross(ap) < 0 {
+			inside = false
+		}
+
+		q := a.Add(e.Scaled(mat.Clamp(ap.Dot(e)/e.Len2(), 0, 1)))
+		if l := q.To(pos).Len2(); best < 0 || l < best {
+			best, closest = l, q
+		}
+	}
+
+	d := closest.To(pos)
+	l := d.Len()
+	if inside {
+		// center is inside, push out trough the nearest edge
+		if l == 0 {
+			return o.Center.To(pos).Normalized().Scaled(radius), true
+		}
+		return d.Scaled(-(l + radius) / l), true
+	}
+	if l >= radius {
+		return mat.ZV, false
+	}
+	return d.Scaled((radius - l) / l), true
+}
@@ -0,0 +1,99 @@
+package game
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// polygon creates obstacle the way assets do, rectangle when points are
+// corners of one
+func polygon(shape assets.Shape, points ...mat.Vec) assets.Obstacle {
+	o := assets.Obstacle{Shape: shape, Points: points}
+	assets.Convex(o.Points)
+	o.Bounds = mat.AABB{Min: points[0], Max: points[0]}
+	for _, p := range points {
+		o.Bounds = o.Bounds.Union(mat.AABB{Min: p, Max: p})
+		o.Center.AddE(p)
+	}
+	o.Center = o.Center.Scaled(1 / float64(len(points)))
+	return o
+}
+
+func TestPush(t *testing.T) {
+	circle := assets.Obstacle{Shape: assets.Circle, Center: mat.V(0, 0), Radius: 10, Bounds: mat.Square(mat.ZV, 10)}
+	rect := polygon(assets.Rect, mat.V(0, 0), mat.V(100, 0), mat.V(100, 20), mat.V(0, 20))
+	// clockwise on purpose, Convex reorders it
+	triangle := polygon(assets.Polygon, mat.V(0, 0), mat.V(0, 100), mat.V(100, 0))
+
+	diag := mat.V(1, 1).Normalized()
+	cases := []struct {
+		desc string
+		o    *assets.Obstacle
+		pos  mat.Vec
+		push mat.Vec
+		ok   bool
+	}{
+		{"circle apart", &circle, mat.V(20, 0), mat.ZV, false},
+		{"circle touching", &circle, mat.V(15, 0), mat.ZV, false},
+		{"circle overlap", &circle, mat.V(12, 0), mat.V(3, 0), true},
+		{"circle inside", &circle, mat.V(0, -3), mat.V(0, -12), true},
+		{"circle center", &circle, mat.V(0, 0), mat.V(15, 0), true},
+
+		{"rect apart", &rect, mat.V(50, -10), mat.ZV, false},
+		{"rect edge", &rect, mat.V(50, -3), mat.V(0, -2), true},
+		{"rect corner", &rect, mat.V(-3, -3), mat.V(-3, -3).Scaled((5 - math.Sqrt(18)) / math.Sqrt(18)), true},
+		{"rect corner apart", &rect, mat.V(-4, -4), mat.ZV, false},
+		{"rect inside bottom", &rect, mat.V(50, 4), mat.V(0, -9), true},
+		{"rect inside right", &rect, mat.V(98, 10), mat.V(7, 0), true},
+
+		{"polygon apart", &triangle, mat.V(60, 60), mat.ZV, false},
+		{"polygon slope", &triangle, mat.V(52, 52), diag.Scaled(5 - 4/math.Sqrt2), true},
+		{"polygon inside", &triangle, mat.V(10, 50), mat.V(-15, 0), true},
+		{"polygon vertex", &triangle, mat.V(103, -1), mat.V(3, -1).Scaled((5 - math.Sqrt(10)) / math.Sqrt(10)), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			push, ok := Push(c.o, c.pos, 5)
+			if ok != c.ok || !near(push.X, c.push.X) || !near(push.Y, c.push.Y) {
+				t.Fatalf("Push(%v) = %v %v, expected %v %v", c.pos, push, ok, c.push, c.ok)
+			}
+			if _, ok := Push(c.o, c.pos.Add(push), 5-1e-6); ok {
+				t.Fatalf("pushed circle at %v still overlaps", c.pos.Add(push))
+			}
+		})
+	}
+}
+
+func TestBulletStopsAtWall(t *testing.T) {
+	w := testWorld(t, "medium", 1)
+	pos := w.Size.Scaled(.5)
+	wall := polygon(assets.Rect, pos.Add(mat.V(100, -50)), pos.Add(mat.V(120, -50)), pos.Add(mat.V(120, 50)), pos.Add(mat.V(100, 50)))
+	w.Obstacles = []assets.Obstacle{wall}
+	w.BuildStatic()
+
+	owner := w.Tanks.Item(w.Player)
+	bl := &owner.Turrets[0].Bullet
+	id := w.CreateBullet(pos, mat.ZV, owner.Group, owner.ID, 0, bl).ID
+	if bl.Speed*bl.LiveTime < 200 {
+		t.Fatal("bullet dies on its own before reaching the wall")
+	}
+
+	last := pos
+	for i := 0; i < TickRate*10; i++ {
+		w.Simulate(w.Step)
+		if !w.Bullets.Used(id) {
+			if last.X < wall.Bounds.Min.X-bl.Size-bl.Speed*w.Step {
+				t.Fatalf("bullet was removed at %v before reaching the wall", last)
+			}
+			return
+		}
+		if last = w.Bullets.Item(id).Pos; last.X > wall.Bounds.Max.X {
+			t.Fatalf("bullet passed trough the wall to %v", last)
+		}
+	}
+	t.Fatal("bullet was not removed")
+}
@@ -0,0 +1,703 @@
+package game
+
+import (
+	"sort"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/sterr"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// NetVersion has to be incremented each time any message changes, client and
+// server with different version refuse each other
+const NetVersion = 12
+
+// MaxEntities bounds ids of tanks and bullets in snapshots, client storage
+// grows up to the id so hostile server cannot make it allocate much
+const MaxEntities = 1 << 16
+
+// Message is the kind of network message, it is always first in the buffer
+// as uint16
+//
+// Hello: version uint16, name string, stats hash uint64
+//
+// Welcome: version uint16, client id uint32, tick rate uint16
+//
+// Reject: version uint16, reason string, it is also sent to kicked client
+//
+// InputFrame: sequence uint32, acknowledged snapshot tick int32, view tick
+// int32, controls, aim, camera center and camera half size
+//
+// Snapshot: tick uint32, acknowledged input sequence uint32, base tick int32 and
+// world delta, base tick -1 means snapshot is full
+//
+// SpawnEvent: tank id uint32, tank index uint16, client uint32, group uint16
+//
+// DeathEvent: victim id int32, victim tank index uint16, killer id int32, killer
+// tank index uint16, killer and its index are -1 if killer is already destroyed
+//
+// Chat: sender name string, text string, team bool, server fills the sender
+// and sends team messages only to the team of sender
+//
+// LobbyState: world index uint16, player count uint32 and for each player id
+// uint32, name string and choice
+//
+// LobbyChoice: team uint16, tank index int16, ready bool, client sends its
+// choice and server fixes it to match the world
+//
+// Start: world index uint16, seed int64, client loads the match
+//
+// Command: text string, client sends console command and server answers with
+// its output
+//
+// Mismatch: stat sources of server, it is sent instead of Welcome when stats
+// hash differs, kind count uint32 and for each kind string and file count
+// uint32 followed by path string and content string of each file
+type Message uint16
+
+const (
+	Hello Message = iota
+	Welcome
+	Reject
+	InputFrame
+	Snapshot
+	SpawnEvent
+	DeathEvent
+	Chat
+	LobbyState
+	LobbyChoice
+	Start
+	Mismatch
+	Command
+)
+
+// MaxChat is maximal length of chat message in bytes
+const MaxChat = 256
+
+var (
+	ErrNetVersion  = sterr.New("protocol version %d is not supported, expected %d")
+	ErrNetMessage  = sterr.New("unexpected message %d")
+	ErrNetCorrupt  = sterr.New("message is corrupted")
+	ErrNetRejected = sterr.New("server refused connection: %s")
+	ErrNetAsset    = sterr.New("asset index %d is out of range")
+	ErrNetStats    = sterr.New("stats differ from server:\n%s")
+	ErrNetForeign  = sterr.New("client has different stats")
+	ErrNetFull     = sterr.New("server is full")
+)
+
+// Tank state fields, bit is set in delta mask if field changed
+const (
+	TankAsset uint16 = 1 << iota
+	TankPos
+	TankVel
+	TankAim
+	TankBaseRot
+	TankTurretRot
+	TankReload
+	TankHealth
+	TankScore
+	TankOwner
+
+	TankAll = 1<<iota - 1
+)
+
+// Bullet state fields, bit is set in delta mask if field changed
+const (
+	BulletAsset uint16 = 1 << iota
+	BulletPos
+	BulletRot
+	BulletLive
+	BulletOwner
+
+	BulletAll = 1<<iota - 1
+)
+
+// TankState is the part of tank that is sent to clients, floats are stored
+// with float32 precision so comparing states is exact
+type TankState struct {
+	ID, Tank                     int
+	Pos, Vel, Aim                mat.Vec
+	BaseRot                      float64
+	TurretRot, Reload            []float64
+	Health, Score, Group, Client int
+	Player                       bool
+}
+
+// BulletState is the part of bullet that is sent to clients, Bullet is index
+// of bullet among bullets of all turrets
+type BulletState struct {
+	ID, Bullet       int
+	Pos              mat.Vec
+	Rot, Live, Speed float64
+	Group, Owner     int
+}
+
+// WorldState is state of all entities in one tick, entities are sorted by id
+type WorldState struct {
+	Tick    int
+	Tanks   []TankState
+	Bullets []BulletState
+}
+
+// State captures current world state
+func (w *World) State() *WorldState {
+	s := &WorldState{Tick: w.Ticks}
+
+	for _, id := range w.Tanks.Occupied() {
+		t := w.Tanks.Item(id)
+		_, idx, _ := w.Assets.Tanks.Tank(t.Tank.Name)
+		ts := TankState{
+			ID:      id,
+			Tank:    idx,
+			Pos:     qv(t.Pos),
+			Vel:     qv(t.Vel),
+			Aim:     qv(t.Aim),
+			BaseRot: q(t.BaseRot),
+			Health:  t.Health,
+			Score:   t.Score,
+			Group:   t.Group,
+			Client:  t.Client,
+			Player:  t.Player,
+		}
+		for i := range t.Guns {
+			ts.TurretRot = append(ts.TurretRot, q(t.Guns[i].Rot))
+			ts.Reload = append(ts.Reload, q(t.Guns[i].Reloader.Progress))
+		}
+		s.Tanks = append(s.Tanks, ts)
+	}
+
+	for _, id := range w.Bullets.Occupied() {
+		b := w.Bullets.Item(id)
+		s.Bullets = append(s.Bullets, BulletState{
+			ID:     id,
+			Bullet: w.BulletIndex(b.Bullet),
+			Pos:    qv(b.Pos),
+			Rot:    q(b.Rot),
+			Speed:  q(b.Speed),
+			Live:   q(b.Live.Progress),
+			Group:  b.Group,
+			Owner:  b.Owner,
+		})
+	}
+
+	return s
+}
+
+// Diff returns mask of fields that differ
+func (s *TankState) Diff(o *TankState) (mask uint16) {
+	if s.Tank != o.Tank {
+		mask |= TankAsset
+	}
+	if s.Pos != o.Pos {
+		mask |= TankPos
+	}
+	if s.Vel != o.Vel {
+		mask |= TankVel
+	}
+	if s.Aim != o.Aim {
+		mask |= TankAim
+	}
+	if s.BaseRot != o.BaseRot {
+		mask |= TankBaseRot
+	}
+	if !sameFloats(s.TurretRot, o.TurretRot) {
+		mask |= TankTurretRot
+	}
+	if !sameFloats(s.Reload, o.Reload) {
+		mask |= TankReload
+	}
+	if s.Health != o.Health {
+		mask |= TankHealth
+	}
+	if s.Score != o.Score {
+		mask |= TankScore
+	}
+	if s.Group != o.Group || s.Client != o.Client || s.Player != o.Player {
+		mask |= TankOwner
+	}
+	return
+}
+
+// Write writes fields selected by mask
+func (s *TankState) Write(b *netw.Buffer, mask uint16) {
+	if mask&TankAsset != 0 {
+		b.PutUint16(uint16(s.Tank))
+	}
+	if mask&TankPos != 0 {
+		putVec32(b, s.Pos)
+	}
+	if mask&TankVel != 0 {
+		putVec32(b, s.Vel)
+	}
+	if mask&TankAim != 0 {
+		putVec32(b, s.Aim)
+	}
+	if mask&TankBaseRot != 0 {
+		b.PutFloat32(float32(s.BaseRot))
+	}
+	if mask&TankTurretRot != 0 {
+		putFloats32(b, s.TurretRot)
+	}
+	if mask&TankReload != 0 {
+		putFloats32(b, s.Reload)
+	}
+	if mask&TankHealth != 0 {
+		b.PutInt32(int32(s.Health))
+	}
+	if mask&TankScore != 0 {
+		b.PutInt32(int32(s.Score))
+	}
+	if mask&TankOwner != 0 {
+		b.PutUint16(uint16(s.Group))
+		b.PutUint32(uint32(s.Client))
+		b.PutBool(s.Player)
+	}
+}
+
+// Read reads fields selected by mask
+func (s *TankState) Read(b *netw.Buffer, mask uint16) {
+	if mask&TankAsset != 0 {
+		s.Tank = int(b.Uint16())
+	}
+	if mask&TankPos != 0 {
+		s.Pos = vec32(b)
+	}
+	if mask&TankVel != 0 {
+		s.Vel = vec32(b)
+	}
+	if mask&TankAim != 0 {
+		s.Aim = vec32(b)
+	}
+	if mask&TankBaseRot != 0 {
+		s.BaseRot = float64(b.Float32())
+	}
+	if mask&TankTurretRot != 0 {
+		s.TurretRot = floats32(b)
+	}
+	if mask&TankReload != 0 {
+		s.Reload = floats32(b)
+	}
+	if mask&TankHealth != 0 {
+		s.Health = int(b.Int32())
+	}
+	if mask&TankScore != 0 {
+		s.Score = int(b.Int32())
+	}
+	if mask&TankOwner != 0 {
+		s.Group = int(b.Uint16())
+		s.Client = int(b.Uint32())
+		s.Player = b.Bool()
+	}
+}
+
+// Diff returns mask of fields that differ
+func (s *BulletState) Diff(o *BulletState) (mask uint16) {
+	if s.Bullet != o.Bullet || s.Speed != o.Speed {
+		mask |= BulletAsset
+	}
+	if s.Pos != o.Pos {
+		mask |= BulletPos
+	}
+	if s.Rot != o.Rot {
+		mask |= BulletRot
+	}
+	if s.Live != o.Live {
+		mask |= BulletLive
+	}
+	if s.Group != o.Group || s.Owner != o.Owner {
+		mask |= BulletOwner
+	}
+	return
+}
+
+// Write writes fields selected by mask
+func (s *BulletState) Write(b *netw.Buffer, mask uint16) {
+	if mask&BulletAsset != 0 {
+		b.PutUint16(uint16(s.Bullet))
+		b.PutFloat32(float32(s.Speed))
+	}
+	if mask&BulletPos != 0 {
+		putVec32(b, s.Pos)
+	}
+	if mask&BulletRot != 0 {
+		b.PutFloat32(float32(s.Rot))
+	}
+	if mask&BulletLive != 0 {
+		b.PutFloat32(float32(s.Live))
+	}
+	if mask&BulletOwner != 0 {
+		b.PutUint16(uint16(s.Group))
+		b.PutUint32(uint32(s.Owner))
+	}
+}
+
+// Read reads fields selected by mask
+func (s *BulletState) Read(b *netw.Buffer, mask uint16) {
+	if mask&BulletAsset != 0 {
+		s.Bullet = int(b.Uint16())
+		s.Speed = float64(b.Float32())
+	}
+	if mask&BulletPos != 0 {
+		s.Pos = vec32(b)
+	}
+	if mask&BulletRot != 0 {
+		s.Rot = float64(b.Float32())
+	}
+	if mask&BulletLive != 0 {
+		s.Live = float64(b.Float32())
+	}
+	if mask&BulletOwner != 0 {
+		s.Group = int(b.Uint16())
+		s.Owner = int(b.Uint32())
+	}
+}
+
+// WriteDelta writes state as difference from base, removed entities are listed
+// by id and changed or new ones are written with mask of changed fields, nil
+// base writes full state
+func WriteDelta(b *netw.Buffer, base, s *WorldState) {
+	if base == nil {
+		base = &WorldState{}
+	}
+
+	var removed, changed []int
+	var masks []uint16
+
+	i, j := 0, 0
+	for i < len(base.Tanks) || j < len(s.Tanks) {
+		switch {
+		case j == len(s.Tanks) || (i < len(base.Tanks) && base.Tanks[i].ID < s.Tanks[j].ID):
+			removed = append(removed, base.Tanks[i].ID)
+			i++
+		case i == len(base.Tanks) || base.Tanks[i].ID > s.Tanks[j].ID:
+			changed = append(changed, j)
+			masks = append(masks, TankAll)
+			j++
+		default:
+			if mask := s.Tanks[j].Diff(&base.Tanks[i]); mask != 0 {
+				changed = append(changed, j)
+				masks = append(masks, mask)
+			}
+			i++
+			j++
+		}
+	}
+
+	putIDs(b, removed)
+	b.PutUint32(uint32(len(changed)))
+	for k, idx := range changed {
+		b.PutUint32(uint32(s.Tanks[idx].ID))
+		b.PutUint16(masks[k])
+		s.Tanks[idx].Write(b, masks[k])
+	}
+
+	removed, changed, masks = removed[:0], changed[:0], masks[:0]
+
+	i, j = 0, 0
+	for i < len(base.Bullets) || j < len(s.Bullets) {
+		switch {
+		case j == len(s.Bullets) || (i < len(base.Bullets) && base.Bullets[i].ID < s.Bullets[j].ID):
+			removed = append(removed, base.Bullets[i].ID)
+			i++
+		case i == len(base.Bullets) || base.Bullets[i].ID > s.Bullets[j].ID:
+			changed = append(changed, j)
+			masks = append(masks, BulletAll)
+			j++
+		default:
+			if mask := s.Bullets[j].Diff(&base.Bullets[i]); mask != 0 {
+				changed = append(changed, j)
+				masks = append(masks, mask)
+			}
+			i++
+			j++
+		}
+	}
+
+	putIDs(b, removed)
+	b.PutUint32(uint32(len(changed)))
+	for k, idx := range changed {
+		b.PutUint32(uint32(s.Bullets[idx].ID))
+		b.PutUint16(masks[k])
+		s.Bullets[idx].Write(b, masks[k])
+	}
+}
+
+// ReadDelta reads state written by WriteDelta against the same base
+func (w *World) ReadDelta(b *netw.Buffer, base *WorldState, tick int) (*WorldState, error) {
+	if base == nil {
+		base = &WorldState{}
+	}
+
+	s := &WorldState{Tick: tick}
+
+	tanks := make(map[int]TankState, len(base.Tanks))
+	for _, t := range base.Tanks {
+		tanks[t.ID] = t
+	}
+	for _, id := range readIDs(b) {
+		delete(tanks, id)
+	}
+	for i, l := 0, readLen(b); i < l; i++ {
+		id := readID(b)
+		mask := b.Uint16()
+		t, ok := tanks[id]
+		if !ok && mask != TankAll {
+			return nil, ErrNetCorrupt
+		}
+		t.ID = id
+		t.Read(b, mask)
+		if t.Tank >= len(w.Assets.Tanks.Slice()) {
+			return nil, ErrNetAsset.Args(t.Tank)
+		}
+		tanks[id] = t
+	}
+
+	bullets := make(map[int]BulletState, len(base.Bullets))
+	for _, bl := range base.Bullets {
+		bullets[bl.ID] = bl
+	}
+	for _, id := range readIDs(b) {
+		delete(bullets, id)
+	}
+	for i, l := 0, readLen(b); i < l; i++ {
+		id := readID(b)
+		mask := b.Uint16()
+		bl, ok := bullets[id]
+		if !ok && mask != BulletAll {
+			return nil, ErrNetCorrupt
+		}
+		bl.ID = id
+		bl.Read(b, mask)
+		if w.BulletAt(bl.Bullet) == nil {
+			return nil, ErrNetAsset.Args(bl.Bullet)
+		}
+		bullets[id] = bl
+	}
+
+	if b.Failed {
+		return nil, ErrNetCorrupt
+	}
+
+	for _, t := range tanks {
+		s.Tanks = append(s.Tanks, t)
+	}
+	sort.Slice(s.Tanks, func(i, j int) bool { return s.Tanks[i].ID < s.Tanks[j].ID })
+	for _, bl := range bullets {
+		s.Bullets = append(s.Bullets, bl)
+	}
+	sort.Slice(s.Bullets, func(i, j int) bool { return s.Bullets[i].ID < s.Bullets[j].ID })
+
+	return s, nil
+}
+
+// InputMessage is content of InputFrame
+type InputMessage struct {
+	// View is tick client displays remote tanks at
+	Seq, Acked, View int
+	Input            binding.S
+	Aim              mat.Vec
+	// Eye and Sight are center and half size of client camera, server sends
+	// only what client can see
+	Eye, Sight mat.Vec
+}
+
+// Write writes input message
+func (m *InputMessage) Write(b *netw.Buffer) {
+	b.PutUint32(uint32(m.Seq))
+	b.PutInt32(int32(m.Acked))
+	b.PutInt32(int32(m.View))
+	m.Input.Write(b)
+	putVec32(b, m.Aim)
+	putVec32(b, m.Eye)
+	putVec32(b, m.Sight)
+}
+
+// Read reads input message, it panics if bindings do not match
+func (m *InputMessage) Read(b *netw.Buffer) {
+	m.Seq = int(b.Uint32())
+	m.Acked = int(b.Int32())
+	m.View = int(b.Int32())
+	m.Input = Bindings.Clone()
+	m.Input.Read(b)
+	m.Aim = vec32(b)
+	m.Eye = vec32(b)
+	m.Sight = vec32(b)
+}
+
+// SpawnMessage is content of SpawnEvent
+type SpawnMessage struct {
+	ID, Tank, Client, Group int
+}
+
+// Write writes spawn message
+func (m *SpawnMessage) Write(b *netw.Buffer) {
+	b.PutUint32(uint32(m.ID))
+	b.PutUint16(uint16(m.Tank))
+	b.PutUint32(uint32(m.Client))
+	b.PutUint16(uint16(m.Group))
+}
+
+// Read reads spawn message
+func (m *SpawnMessage) Read(b *netw.Buffer) {
+	m.ID = int(b.Uint32())
+	m.Tank = int(b.Uint16())
+	m.Client = int(b.Uint32())
+	m.Group = int(b.Uint16())
+}
+
+// DeathMessage is content of DeathEvent
+type DeathMessage struct {
+	Victim, VictimTank, Killer, KillerTank int
+}
+
+// Write writes death message
+func (m *DeathMessage) Write(b *netw.Buffer) {
+	b.PutInt32(int32(m.Victim))
+	b.PutInt16(int16(m.VictimTank))
+	b.PutInt32(int32(m.Killer))
+	b.PutInt16(int16(m.KillerTank))
+}
+
+// Read reads death message
+func (m *DeathMessage) Read(b *netw.Buffer) {
+	m.Victim = int(b.Int32())
+	m.VictimTank = int(b.Int16())
+	m.Killer = int(b.Int32())
+	m.KillerTank = int(b.Int16())
+}
+
+// ChatMessage is content of Chat
+type ChatMessage struct {
+	From, Text string
+	Team       bool
+	// Sender is id of client that sent the message, it is not sent
+	Sender int
+}
+
+// Write writes chat message
+func (m *ChatMessage) Write(b *netw.Buffer) {
+	b.PutString(m.From)
+	b.PutString(m.Text)
+	b.PutBool(m.Team)
+}
+
+// Read reads chat message, text is cut to MaxChat
+func (m *ChatMessage) Read(b *netw.Buffer) {
+	m.From = b.String()
+	m.Text = b.String()
+	m.Team = b.Bool()
+	if len(m.Text) > MaxChat {
+		m.Text = m.Text[:MaxChat]
+	}
+}
+
+// putSources writes stat sources, kinds are sorted so message is always same
+func putSources(b *netw.Buffer, sources map[string][]assets.File) {
+	kinds := make([]string, 0, len(sources))
+	for k := range sources {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	b.PutUint32(uint32(len(kinds)))
+	for _, k := range kinds {
+		b.PutString(k)
+		b.PutUint32(uint32(len(sources[k])))
+		for _, f := range sources[k] {
+			b.PutString(f.Path)
+			b.PutString(string(f.Data))
+		}
+	}
+}
+
+func readSources(b *netw.Buffer) map[string][]assets.File {
+	sources := map[string][]assets.File{}
+	for i := readLen(b); i > 0 && !b.Failed; i-- {
+		k := b.String()
+		files := make([]assets.File, readLen(b))
+		for j := range files {
+			files[j].Path = b.String()
+			files[j].Data = []byte(b.String())
+		}
+		sources[k] = files
+	}
+	return sources
+}
+
+func putIDs(b *netw.Buffer, ids []int) {
+	b.PutUint32(uint32(len(ids)))
+	for _, id := range ids {
+		b.PutUint32(uint32(id))
+	}
+}
+
+func readIDs(b *netw.Buffer) []int {
+	ids := make([]int, readLen(b))
+	for i := range ids {
+		ids[i] = readID(b)
+	}
+	return ids
+}
+
+// readID reads storage id, ids are bounded by MaxEntities
+func readID(b *netw.Buffer) int {
+	id := int(b.Uint32())
+	if id >= MaxEntities {
+		b.Failed = true
+		return -1
+	}
+	return id
+}
+
+// putFloats32 writes length prefixed floats with float32 precision
+func putFloats32(b *netw.Buffer, fs []float64) {
+	b.PutUint16(uint16(len(fs)))
+	for _, f := range fs {
+		b.PutFloat32(float32(f))
+	}
+}
+
+func floats32(b *netw.Buffer) []float64 {
+	l := int(b.Uint16())
+	if l > MaxTurrets || b.Failed {
+		b.Failed = true
+		return nil
+	}
+	fs := make([]float64, l)
+	for i := range fs {
+		fs[i] = float64(b.Float32())
+	}
+	return fs
+}
+
+func sameFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func putVec32(b *netw.Buffer, v mat.Vec) {
+	b.PutFloat32(float32(v.X))
+	b.PutFloat32(float32(v.Y))
+}
+
+func vec32(b *netw.Buffer) mat.Vec {
+	return mat.V(float64(b.Float32()), float64(b.Float32()))
+}
+
+// q rounds float to float32 precision
+func q(f float64) float64 {
+	return float64(float32(f))
+}
+
+func qv(v mat.Vec) mat.Vec {
+	return mat.V(q(v.X), q(v.Y))
+}
@@ -0,0 +1,40 @@
+//go:build go1.18
+// +build go1.18
+
+package game
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+)
+
+// FuzzDelta feeds arbitrary snapshots to ReadDelta, it must never panic and
+// whatever it accepts has to survive encoding and decoding unchanged
+func FuzzDelta(f *testing.F) {
+	w, base, s := testStates(f)
+	f.Add(encode(func(b *netw.Buffer) { WriteDelta(b, nil, s) }).Data)
+	f.Add(encode(func(b *netw.Buffer) { WriteDelta(b, base, s) }).Data)
+	f.Add(encode(func(b *netw.Buffer) { WriteDelta(b, base, base) }).Data)
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, bs := range []*WorldState{nil, base} {
+			st, err := w.ReadDelta(&netw.Buffer{Data: data}, bs, 1)
+			if err != nil {
+				continue
+			}
+
+			first := encode(func(b *netw.Buffer) { WriteDelta(b, nil, st) }).Data
+			again, err := w.ReadDelta(&netw.Buffer{Data: first}, nil, 1)
+			if err != nil {
+				t.Fatalf("accepted state cannot be decoded after encoding: %v", err)
+			}
+			second := encode(func(b *netw.Buffer) { WriteDelta(b, nil, again) }).Data
+			if !bytes.Equal(first, second) {
+				t.Fatal("state changed after round trip")
+			}
+		}
+	})
+}
@@ -0,0 +1,409 @@
+package game
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// encode returns buffer with what write wrote, ready for reading
+func encode(write func(b *netw.Buffer)) *netw.Buffer {
+	var b netw.Buffer
+	write(&b)
+	return &netw.Buffer{Data: b.Data}
+}
+
+// finished fails the test if buffer failed or was not read whole
+func finished(t *testing.T, b *netw.Buffer) {
+	t.Helper()
+	if b.Failed || !b.Finished() {
+		t.Fatalf("buffer failed: %v, finished: %v", b.Failed, b.Finished())
+	}
+}
+
+// testStates returns two states of running match, base is older
+func testStates(t testing.TB) (w *World, base, s *WorldState) {
+	w = testWorld(t, "medium", 7)
+	simulate(w, 900)
+	base = w.State()
+	for i := 0; i < 100; i++ {
+		simulate(w, 10)
+		s = w.State()
+		if len(s.Tanks) > 2 && len(s.Bullets) != 0 {
+			return
+		}
+	}
+	t.Fatal("match is too empty to test snapshots")
+	return
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	t.Run("input", func(t *testing.T) {
+		in := InputMessage{Seq: 10, Acked: -1, View: 7, Input: Bindings.Clone(), Aim: mat.V(1, 2), Eye: mat.V(3, 4), Sight: mat.V(5, 6)}
+		in.Input[Forward].State = binding.Pressed
+		in.Input[Shoot].State = binding.JustPressed
+
+		b := encode(in.Write)
+		var out InputMessage
+		out.Read(b)
+		finished(t, b)
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+	})
+
+	t.Run("spawn", func(t *testing.T) {
+		in := SpawnMessage{ID: 3, Tank: 2, Client: 5, Group: 1}
+		b := encode(in.Write)
+		var out SpawnMessage
+		out.Read(b)
+		finished(t, b)
+		if in != out {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+	})
+
+	t.Run("death", func(t *testing.T) {
+		in := DeathMessage{Victim: 4, VictimTank: 1, Killer: -1, KillerTank: -1}
+		b := encode(in.Write)
+		var out DeathMessage
+		out.Read(b)
+		finished(t, b)
+		if in != out {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+	})
+
+	t.Run("chat", func(t *testing.T) {
+		in := ChatMessage{From: "player", Text: "hello", Team: true}
+		b := encode(in.Write)
+		var out ChatMessage
+		out.Read(b)
+		finished(t, b)
+		if in != out {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+
+		in.Text = strings.Repeat("a", MaxChat*2)
+		b = encode(in.Write)
+		out.Read(b)
+		if len(out.Text) != MaxChat {
+			t.Fatalf("chat is not cut, it has %d bytes", len(out.Text))
+		}
+	})
+
+	t.Run("lobby", func(t *testing.T) {
+		in := Lobby{World: 2, Players: []LobbyPlayer{
+			{ID: 1, Name: "a", Team: 1, Tank: -1, Ready: true},
+			{ID: 4, Name: "b", Team: 0, Tank: 3},
+		}}
+		b := encode(in.Write)
+		var out Lobby
+		out.Read(b)
+		finished(t, b)
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+	})
+
+	t.Run("choice", func(t *testing.T) {
+		in := LobbyPlayer{Team: 3, Tank: -1, Ready: true}
+		b := encode(in.Write)
+		var out LobbyPlayer
+		out.Read(b)
+		finished(t, b)
+		if in != out {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		in := map[string][]assets.File{
+			"Tanks":   {{Path: "tanks.goss", Data: []byte("tank1{}")}},
+			"Bullets": {{Path: "a.goss", Data: []byte("")}, {Path: "b.goss", Data: []byte("b{}")}},
+		}
+		b := encode(func(b *netw.Buffer) { putSources(b, in) })
+		out := readSources(b)
+		finished(t, b)
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("%v != %v", in, out)
+		}
+	})
+
+	t.Run("announcement", func(t *testing.T) {
+		in := Announcement{Name: "host", Map: "medium", Transport: "udp", Version: NetVersion, Port: 7777, Players: 3}
+		b := encode(in.Write)
+		var out Announcement
+		if err := out.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		finished(t, b)
+		if in != out {
+			t.Fatalf("%+v != %+v", in, out)
+		}
+	})
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	w, base, s := testStates(t)
+
+	for _, c := range []struct {
+		name string
+		base *WorldState
+	}{
+		{"full", nil},
+		{"delta", base},
+		{"same", s},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := encode(func(b *netw.Buffer) { WriteDelta(b, c.base, s) })
+			out, err := w.ReadDelta(b, c.base, s.Tick)
+			if err != nil {
+				t.Fatal(err)
+			}
+			finished(t, b)
+			if !reflect.DeepEqual(s, out) {
+				t.Fatal("decoded state differs")
+			}
+		})
+	}
+
+	// small message about entity with large id
+	t.Run("large id", func(t *testing.T) {
+		for _, id := range []int{500, MaxEntities - 1} {
+			one := &WorldState{Tick: s.Tick, Tanks: []TankState{s.Tanks[0]}, Bullets: []BulletState{s.Bullets[0]}}
+			one.Tanks[0].ID, one.Bullets[0].ID = id, id
+			moved := *one
+			moved.Tanks = []TankState{one.Tanks[0]}
+			moved.Tanks[0].Pos = moved.Tanks[0].Pos.Add(mat.V(1, 0))
+
+			for _, c := range []struct{ base, s *WorldState }{{nil, one}, {one, &moved}} {
+				b := encode(func(b *netw.Buffer) { WriteDelta(b, c.base, c.s) })
+				out, err := w.ReadDelta(b, c.base, c.s.Tick)
+				if err != nil {
+					t.Fatalf("id %d in message of %d bytes: %v", id, len(b.Data), err)
+				}
+				if !reflect.DeepEqual(c.s, out) {
+					t.Fatalf("id %d: decoded state differs", id)
+				}
+			}
+		}
+
+		b := encode(func(b *netw.Buffer) {
+			b.PutUint32(MaxEntities)
+		})
+		if id := readID(b); id != -1 || !b.Failed {
+			t.Fatalf("id %d over limit was accepted", id)
+		}
+	})
+
+	full := encode(func(b *netw.Buffer) { WriteDelta(b, nil, s) })
+	delta := encode(func(b *netw.Buffer) { WriteDelta(b, base, s) })
+	if len(delta.Data) >= len(full.Data) {
+		t.Fatalf("delta has %d bytes, full snapshot %d", len(delta.Data), len(full.Data))
+	}
+}
+
+func TestReadBounds(t *testing.T) {
+	w, base, s := testStates(t)
+
+	t.Run("truncated", func(t *testing.T) {
+		for _, bs := range []*WorldState{nil, base} {
+			data := encode(func(b *netw.Buffer) { WriteDelta(b, bs, s) }).Data
+			for i := 0; i < len(data); i++ {
+				if _, err := w.ReadDelta(&netw.Buffer{Data: data[:i]}, bs, s.Tick); err == nil {
+					t.Fatalf("snapshot cut to %d of %d bytes was accepted", i, len(data))
+				}
+			}
+		}
+	})
+
+	t.Run("lengths", func(t *testing.T) {
+		b := encode(func(b *netw.Buffer) { b.PutUint32(1 << 31) })
+		if l := readLen(b); l != 0 || !b.Failed {
+			t.Fatalf("hostile length %d was accepted", l)
+		}
+
+		b = encode(func(b *netw.Buffer) { b.PutUint32(1 << 31) })
+		if id := readID(b); id != -1 || !b.Failed {
+			t.Fatalf("hostile id %d was accepted", id)
+		}
+
+		b = encode(func(b *netw.Buffer) { b.PutUint16(MaxTurrets + 1) })
+		if fs := floats32(b); fs != nil || !b.Failed {
+			t.Fatal("hostile turret count was accepted")
+		}
+
+		b = encode(func(b *netw.Buffer) {
+			b.PutUint16(0)
+			b.PutUint32(1 << 31)
+		})
+		var l Lobby
+		l.Read(b)
+		if !b.Failed || len(l.Players) != 0 {
+			t.Fatal("hostile player count was accepted")
+		}
+
+		b = encode(func(b *netw.Buffer) {
+			b.PutUint32(1)
+			b.PutString("Tanks")
+			b.PutUint32(1 << 31)
+		})
+		if readSources(b); !b.Failed {
+			t.Fatal("hostile file count was accepted")
+		}
+
+		b = encode(func(b *netw.Buffer) {
+			b.PutUint32(1 << 31)
+			b.PutUint32(1 << 31)
+		})
+		if _, err := w.ReadDelta(b, nil, 0); err == nil {
+			t.Fatal("hostile entity counts were accepted")
+		}
+	})
+
+	t.Run("assets", func(t *testing.T) {
+		st := &WorldState{Tanks: []TankState{s.Tanks[0]}}
+		st.Tanks[0].Tank = len(w.Assets.Tanks.Slice())
+		b := encode(func(b *netw.Buffer) { WriteDelta(b, nil, st) })
+		if _, err := w.ReadDelta(b, nil, 0); !ErrNetAsset.SameSurface(err) {
+			t.Fatalf("expected asset error, got %v", err)
+		}
+
+		st = &WorldState{Bullets: []BulletState{s.Bullets[0]}}
+		st.Bullets[0].Bullet = 1<<16 - 1
+		b = encode(func(b *netw.Buffer) { WriteDelta(b, nil, st) })
+		if _, err := w.ReadDelta(b, nil, 0); !ErrNetAsset.SameSurface(err) {
+			t.Fatalf("expected asset error, got %v", err)
+		}
+	})
+
+	t.Run("unknown base", func(t *testing.T) {
+		// delta against base client does not have
+		b := encode(func(b *netw.Buffer) { WriteDelta(b, base, s) })
+		if _, err := w.ReadDelta(b, nil, s.Tick); err == nil {
+			t.Fatal("delta was applied to wrong base")
+		}
+	})
+}
+
+// fakeConn records sent messages and delivers nothing
+type fakeConn struct {
+	sent  [][]byte
+	inbox chan netw.Buffer
+}
+
+func (c *fakeConn) Inbox() <-chan netw.Buffer {
+	return c.inbox
+}
+
+func (c *fakeConn) Send(data []byte, reliable bool) {
+	c.sent = append(c.sent, append([]byte(nil), data...))
+}
+
+func (c *fakeConn) Err() error {
+	return nil
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func (c *fakeConn) Close() {}
+
+func hello(version uint16, name string, hash uint64) *netw.Buffer {
+	return encode(func(b *netw.Buffer) {
+		b.PutUint16(uint16(Hello))
+		b.PutUint16(version)
+		b.PutString(name)
+		b.PutUint64(hash)
+	})
+}
+
+func TestServerRejectsVersion(t *testing.T) {
+	s := host(t, TCP{}, "hard")
+	c := &fakeConn{inbox: make(chan netw.Buffer)}
+	ss := &Session{Net: NNet(c), ID: 1, Tank: -1, Acked: -1}
+
+	err := s.Handle(ss, hello(NetVersion+1, "old", s.Stats.Hash()))
+	if !ErrNetVersion.SameSurface(err) {
+		t.Fatalf("expected version error, got %v", err)
+	}
+	if len(c.sent) != 1 {
+		t.Fatalf("expected one reply, got %d", len(c.sent))
+	}
+	r := &netw.Buffer{Data: c.sent[0]}
+	if m := Message(r.Uint16()); m != Reject {
+		t.Fatalf("expected Reject, got %d", m)
+	}
+	if v := r.Uint16(); v != NetVersion {
+		t.Fatalf("reject carries version %d", v)
+	}
+	if ss.Name != "" || len(s.Server.Lobby.Players) != 0 {
+		t.Fatal("rejected client joined")
+	}
+}
+
+func TestClientRejectsVersion(t *testing.T) {
+	l, err := TCP{}.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := NNet(conn)
+		<-n.Inbox
+		b := n.Message(Welcome)
+		b.PutUint16(NetVersion + 1)
+		b.PutUint32(1)
+		b.PutUint16(TickRate)
+		n.Send(b)
+		time.Sleep(100 * time.Millisecond)
+	}()
+
+	c := NHeadlessWorld(loadAssets(t))
+	err = c.Connect("127.0.0.1:"+strconv.Itoa(l.Port()), "new")
+	if !ErrNetVersion.SameSurface(err) {
+		t.Fatalf("expected version error, got %v", err)
+	}
+	if c.Client != nil {
+		t.Fatal("client stayed connected")
+	}
+}
+
+func TestServerRejectsSecondHello(t *testing.T) {
+	s := host(t, TCP{}, "hard")
+	c := &fakeConn{inbox: make(chan netw.Buffer)}
+	ss := &Session{Net: NNet(c), ID: 1, Tank: -1, Acked: -1}
+
+	if err := s.Handle(ss, hello(NetVersion, "first", s.Stats.Hash())); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Handle(ss, hello(NetVersion, "second", s.Stats.Hash())); err != nil {
+		t.Fatal(err)
+	}
+
+	if ss.Name != "first" {
+		t.Fatalf("second hello renamed client to %q", ss.Name)
+	}
+	if l := len(s.Server.Lobby.Players); l != 1 {
+		t.Fatalf("client is %d times in lobby", l)
+	}
+	if ss.Violations != 1 {
+		t.Fatalf("second hello counted as %d violations", ss.Violations)
+	}
+}
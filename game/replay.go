@@ -0,0 +1,254 @@
+package game
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/sterr"
+)
+
+// replay file properties, ReplayVersion has to be incremented each time format changes
+const (
+	ReplayHeader  = "go-tanks replay"
+	ReplayVersion = 2
+	ReplayDir     = "replays"
+	ReplayExt     = ".replay"
+)
+
+var (
+	ErrReplayHeader  = sterr.New("file is not a replay")
+	ErrReplayVersion = sterr.New("replay version %d is not supported, expected %d")
+	ErrReplayCorrupt = sterr.New("replay is corrupted")
+	ErrReplayWorld   = sterr.New("replay world %q is not loaded")
+	ErrReplayMods    = sterr.New("replay was recorded with mods %v but game has %v")
+)
+
+// Input is state of player tank controls in one tick
+type Input struct {
+	ID    int
+	State binding.S
+	Aim   mat.Vec
+}
+
+// Replay is recording of player inputs, with the seed and world it is enough
+// to reproduce whole match
+type Replay struct {
+	World  string
+	Seed   int64
+	Step   float64
+	Mods   []string
+	Frames [][]Input
+	Kills  []Kill
+}
+
+// NReplay creates empty replay of currently loaded world
+func (w *World) NReplay() *Replay {
+	return &Replay{
+		World: w.Name,
+		Seed:  w.Seed,
+		Step:  w.Step,
+		Mods:  append([]string(nil), w.Assets.Mods...),
+	}
+}
+
+// Record appends inputs of all player tanks as a new frame
+func (r *Replay) Record(w *World) {
+	var frame []Input
+	for _, id := range w.Tanks.Occupied() {
+		t := w.Tanks.Item(id)
+		if !t.Player {
+			continue
+		}
+		frame = append(frame, Input{
+			ID:    id,
+			State: t.Input.Clone(),
+			Aim:   t.Aim,
+		})
+	}
+	r.Frames = append(r.Frames, frame)
+}
+
+// Apply feeds the recorded inputs of given tick into player tanks, it returns false
+// if there are no more frames
+func (r *Replay) Apply(w *World, tick int) bool {
+	if tick >= len(r.Frames) {
+		return false
+	}
+
+	for _, in := range r.Frames[tick] {
+		if !w.Tanks.Used(in.ID) {
+			continue
+		}
+		t := w.Tanks.Item(in.ID)
+		copy(t.Input, in.State)
+		t.Aim = in.Aim
+	}
+
+	return true
+}
+
+// Write writes replay to buffer
+func (r *Replay) Write(b *netw.Buffer) {
+	b.PutString(ReplayHeader)
+	b.PutUint16(ReplayVersion)
+	b.PutString(r.World)
+	b.PutInt64(r.Seed)
+	b.PutFloat64(r.Step)
+
+	b.PutUint32(uint32(len(r.Mods)))
+	for _, m := range r.Mods {
+		b.PutString(m)
+	}
+
+	b.PutUint32(uint32(len(r.Frames)))
+	for _, f := range r.Frames {
+		b.PutUint16(uint16(len(f)))
+		for _, in := range f {
+			b.PutInt(in.ID)
+			in.State.Write(b)
+			b.PutVec(in.Aim)
+		}
+	}
+
+	b.PutUint32(uint32(len(r.Kills)))
+	for _, k := range r.Kills {
+		b.PutInt(k.Tick)
+		b.PutString(k.Killer)
+		b.PutString(k.Victim)
+	}
+}
+
+// Read reads replay from buffer
+func (r *Replay) Read(b *netw.Buffer) (err error) {
+	defer func() {
+		// binding.S panics on length mismatch
+		if rec := recover(); rec != nil {
+			err = ErrReplayCorrupt.Wrap(fmt.Errorf("%v", rec))
+		}
+	}()
+
+	if b.String() != ReplayHeader {
+		return ErrReplayHeader
+	}
+	if v := b.Uint16(); v != ReplayVersion {
+		return ErrReplayVersion.Args(v, ReplayVersion)
+	}
+
+	r.World = b.String()
+	r.Seed = b.Int64()
+	r.Step = b.Float64()
+
+	r.Mods = make([]string, readLen(b))
+	for i := range r.Mods {
+		r.Mods[i] = b.String()
+	}
+
+	r.Frames = make([][]Input, readLen(b))
+	for i := range r.Frames {
+		f := make([]Input, b.Uint16())
+		for j := range f {
+			f[j].ID = b.Int()
+			f[j].State = Bindings.Clone()
+			f[j].State.Read(b)
+			f[j].Aim = b.Vec()
+		}
+		r.Frames[i] = f
+
+		if b.Failed {
+			return ErrReplayCorrupt
+		}
+	}
+
+	r.Kills = make([]Kill, readLen(b))
+	for i := range r.Kills {
+		r.Kills[i] = Kill{b.Int(), b.String(), b.String()}
+	}
+
+	if b.Failed {
+		return ErrReplayCorrupt
+	}
+
+	return nil
+}
+
+// Save saves replay to replay directory in app data, file is named after current time
+func (r *Replay) Save(root string) (string, error) {
+	dir := path.Join(root, ReplayDir)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	var b netw.Buffer
+	r.Write(&b)
+
+	p := path.Join(dir, strconv.FormatInt(time.Now().Unix(), 10)+ReplayExt)
+	return p, ioutil.WriteFile(p, b.Data, os.ModePerm)
+}
+
+// LoadReplay loads replay from file
+func LoadReplay(p string) (*Replay, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replay{}
+	return r, r.Read(&netw.Buffer{Data: bts})
+}
+
+// PlayReplay loads the replay world with its seed and step, player tanks will then
+// be controlled by recorded inputs instead of window
+func (w *World) PlayReplay(r *Replay) error {
+	world, _, ok := w.Assets.Worlds.World(r.World)
+	if !ok {
+		return ErrReplayWorld.Args(r.World)
+	}
+
+	if len(r.Mods) != len(w.Assets.Mods) {
+		return ErrReplayMods.Args(r.Mods, w.Assets.Mods)
+	}
+	for i, m := range r.Mods {
+		if w.Assets.Mods[i] != m {
+			return ErrReplayMods.Args(r.Mods, w.Assets.Mods)
+		}
+	}
+
+	w.Step = r.Step
+	w.LoadMapSeed(Singleplayer, world, r.Seed)
+	w.Recorder = nil
+	w.Playback = r
+
+	return nil
+}
+
+// SaveRecording saves currently recorded match if there is any
+func (w *World) SaveRecording() {
+	if w.Recorder == nil {
+		return
+	}
+
+	_, err := w.Recorder.Save(w.AppData.Root)
+	if err != nil {
+		fmt.Println(err)
+	}
+	w.Recorder = nil
+}
+
+// readLen reads length prefix and makes sure it can fit into buffer so corrupted
+// data does not cause huge allocations
+func readLen(b *netw.Buffer) int {
+	l := int(b.Uint32())
+	if l > len(b.Data) {
+		b.Failed = true
+		return 0
+	}
+	return l
+}
@@ -0,0 +1,58 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/mat"
+)
+
+func TestReplayPlayback(t *testing.T) {
+	const ticks = 1200
+	w := testWorld(t, "medium", 5)
+	w.Recorder = w.NReplay()
+
+	// player drives in circles and shoots in bursts
+	for i := 0; i < ticks; i++ {
+		if w.Player != -1 && w.Tanks.Used(w.Player) {
+			p := w.Tanks.Item(w.Player)
+			p.Input[Forward].State = binding.Pressed
+			p.Input[Left].State = binding.Released
+			if i/60%2 == 0 {
+				p.Input[Left].State = binding.Pressed
+			}
+			p.Input[Shoot].State = binding.Released
+			if i%20 < 10 {
+				p.Input[Shoot].State = binding.Pressed
+			}
+			p.Aim = p.Pos.Add(mat.Rad(float64(i)*.05, 200))
+		}
+		w.Simulate(w.Step)
+	}
+
+	var b netw.Buffer
+	w.Recorder.Write(&b)
+	var r Replay
+	if err := r.Read(&netw.Buffer{Data: b.Data}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Frames) != ticks {
+		t.Fatalf("replay has %d frames, expected %d", len(r.Frames), ticks)
+	}
+
+	p := NHeadlessWorld(w.Assets)
+	if err := p.PlayReplay(&r); err != nil {
+		t.Fatal(err)
+	}
+	simulate(p, ticks)
+	sameState(t, w, p)
+
+	// without recorded inputs match goes differently
+	idle := testWorld(t, "medium", 5)
+	simulate(idle, ticks)
+	if reflect.DeepEqual(idle.Capture(), w.Capture()) {
+		t.Fatal("recorded inputs did not affect the match")
+	}
+}
@@ -0,0 +1,126 @@
+package game
+
+import (
+	"github.com/jakubDoka/mlok/logic/spatial"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// MaxRewind is maximal amount of ticks server rewinds tanks for bullets of
+// lagging clients, clients that see older world have to lead their shots
+const MaxRewind = TickRate / 4
+
+// Pose is where tank was in one tick
+type Pose struct {
+	ID, Group int
+	Tank      *assets.Tank
+	Pos       mat.Vec
+	Address   mat.Point
+}
+
+// Frame holds poses of one tick, Hasher indexes them by position, ids in it
+// are indexes into Poses
+type Frame struct {
+	Tick   int
+	Poses  []Pose
+	Hasher spatial.MinHash
+}
+
+// Rewind is ring of recent tank poses, one frame per tick
+type Rewind struct {
+	Frames [MaxRewind + 1]Frame
+}
+
+// Record stores poses of all living tanks in current tick
+func (r *Rewind) Record(w *World) {
+	f := &r.Frames[w.Ticks%len(r.Frames)]
+	if f.Hasher.Nodes == nil {
+		size := w.Size.Div(w.Tile).Point()
+		f.Hasher = spatial.NMinHash(size.X, size.Y, w.Tile)
+	}
+	for i, p := range f.Poses {
+		f.Hasher.Remove(p.Address, i, p.Group)
+	}
+
+	f.Poses = f.Poses[:0]
+	for _, id := range w.Tanks.Occupied() {
+		t := w.Tanks.Item(id)
+		if t.Dead() {
+			continue
+		}
+		f.Poses = append(f.Poses, Pose{ID: id, Group: t.Group, Tank: t.Tank, Pos: t.Pos})
+		i := len(f.Poses) - 1
+		f.Hasher.Insert(&f.Poses[i].Address, t.Pos, i, t.Group)
+	}
+	f.Tick = w.Ticks
+}
+
+// At returns frame of tick or nil if it is not recorded
+func (r *Rewind) At(tick int) *Frame {
+	if tick < 0 {
+		return nil
+	}
+	f := &r.Frames[tick%len(r.Frames)]
+	if f.Tick != tick {
+		return nil
+	}
+	return f
+}
+
+// Clear forgets all poses, hashers are rebuilt as next map can differ in size
+func (r *Rewind) Clear() {
+	for i := range r.Frames {
+		r.Frames[i] = Frame{Tick: -1, Poses: r.Frames[i].Poses[:0]}
+	}
+}
+
+// Session returns session of client or nil
+func (s *Server) Session(client int) *Session {
+	for _, ss := range s.Sessions {
+		if ss.ID == client {
+			return ss
+		}
+	}
+	return nil
+}
+
+// RewindOf returns how many ticks behind client sees the world at tick,
+// local and ai tanks see it as it is
+func (s *Server) RewindOf(client, tick int) int {
+	if client == 0 {
+		return 0
+	}
+
+	ss := s.Session(client)
+	if ss == nil || ss.View < 0 || ss.View > tick {
+		return 0
+	}
+
+	if r := tick - ss.View; r < MaxRewind {
+		return r
+	}
+	return MaxRewind
+}
+
+// RewoundHit returns id of tank bullet hits in frame or -1, tank has to still
+// exist as the same tank
+func (w *World) RewoundHit(b *Bullet, f *Frame) int {
+	w.Buff = f.Hasher.Query(mat.Square(b.Pos, b.Size), w.Buff[:0], b.Group, false)
+	for _, i := range w.Buff {
+		p := &f.Poses[i]
+		if !w.Tanks.Used(p.ID) {
+			continue
+		}
+
+		t := w.Tanks.Item(p.ID)
+		if t.Dead() || t.Tank != p.Tank || t.Group != p.Group {
+			continue
+		}
+
+		if mat.C(p.Pos.X, p.Pos.Y, t.Size).Intersects(mat.C(b.Pos.X, b.Pos.Y, b.Size)) {
+			return p.ID
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,76 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jakubDoka/mlok/mat"
+)
+
+func TestRewindDelayedInputs(t *testing.T) {
+	s := host(t, TCP{}, "hard")
+	c := join(t, s, "tester")
+	start(t, s, c)
+
+	// inputs of client reach server late, so they report old views
+	const delay = 6
+	step := time.Duration(s.Step * float64(time.Second))
+	clock := NFakeClock(time.Now())
+	// wakes delayed messages so lagged connection can close
+	defer clock.Advance(time.Minute)
+	ss := s.Server.Sessions[0]
+	ss.Net = NNet(NLagConn(ss.Net.Conn, &Lag{Latency: delay * step, Clock: clock}))
+
+	player := s.SessionTank(ss)
+	if player == nil {
+		t.Fatal("client has no tank")
+	}
+
+	var (
+		rewind int
+		enemy  *Pose
+	)
+	deadline := time.Now().Add(10 * time.Second)
+	for seq := 1; enemy == nil; seq++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("no enemy to shoot at, rewind is %d", rewind)
+		}
+		sendInput(c, seq, Bindings)
+		s.Serve(s.Step)
+		clock.Advance(step)
+		time.Sleep(time.Millisecond)
+		if err := c.Sync(); err != nil {
+			t.Fatal(err)
+		}
+
+		rewind = s.Server.RewindOf(ss.ID, s.Ticks)
+		if rewind <= delay {
+			continue
+		}
+		if f := s.Server.Rewind.At(s.Ticks - rewind); f != nil {
+			for i := range f.Poses {
+				if f.Poses[i].Group != player.Group {
+					enemy = &f.Poses[i]
+					break
+				}
+			}
+		}
+	}
+	if rewind > MaxRewind {
+		t.Fatalf("rewind %d exceeds limit", rewind)
+	}
+
+	// enemy already left the place client saw it at
+	e := s.Tanks.Item(enemy.ID)
+	e.Pos = enemy.Pos.Add(mat.V(e.Size*4, 0))
+	s.Hasher.Update(&e.Address, e.Pos, e.ID, e.Group)
+
+	b := &Bullet{Bullet: s.BulletAt(0), Pos: enemy.Pos, Group: player.Group, Owner: player.ID, Rewind: rewind}
+	if id := s.BulletHit(b); id != enemy.ID {
+		t.Fatalf("rewound bullet hit %d instead of %d", id, enemy.ID)
+	}
+	b.Rewind = 0
+	if id := s.BulletHit(b); id == enemy.ID {
+		t.Fatal("bullet without rewind hit tank that moved away")
+	}
+}
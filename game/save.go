@@ -0,0 +1,388 @@
+package game
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/logic/spatial"
+	"github.com/jakubDoka/mlok/logic/timer"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/sterr"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// save file properties, SaveVersion has to be incremented each time format changes
+const (
+	SaveHeader  = "go-tanks save"
+	SaveVersion = 5
+	SaveFile    = "save.bin"
+)
+
+var (
+	ErrSaveHeader  = sterr.New("file is not a save")
+	ErrSaveVersion = sterr.New("save version %d is not supported, expected %d")
+	ErrSaveCorrupt = sterr.New("save is corrupted")
+	ErrSaveWorld   = sterr.New("saved world %q is not loaded")
+	ErrSaveTank    = sterr.New("saved tank %q is not loaded")
+	ErrSaveTurret  = sterr.New("saved tank %q has no turret %d")
+)
+
+// SavePath returns path to the save file
+func (w *World) SavePath() string {
+	return path.Join(w.AppData.Root, SaveFile)
+}
+
+// HasSave returns whether there is a match to continue
+func (w *World) HasSave() bool {
+	_, err := os.Stat(w.SavePath())
+	return err == nil
+}
+
+// SaveMatch writes state of running match to save file
+func (w *World) SaveMatch() error {
+	var b netw.Buffer
+	w.WriteCheckpoint(&b, w.Capture())
+	return ioutil.WriteFile(w.SavePath(), b.Data, os.ModePerm)
+}
+
+// ContinueMatch loads match from save file and removes the file
+func (w *World) ContinueMatch() error {
+	bts, err := ioutil.ReadFile(w.SavePath())
+	if err != nil {
+		return err
+	}
+
+	c, err := w.ReadCheckpoint(&netw.Buffer{Data: bts})
+	if err != nil {
+		return err
+	}
+
+	world, _, _ := w.Assets.Worlds.World(c.World.Name)
+	w.LoadMapSeed(Singleplayer, world, c.World.Seed)
+	// saved match cannot be reproduced from the start
+	w.Recorder = nil
+	w.Restore(c)
+	w.UpdateScore()
+
+	return os.Remove(w.SavePath())
+}
+
+// WriteCheckpoint writes checkpoint to buffer, assets are saved by name
+func (w *World) WriteCheckpoint(b *netw.Buffer, c *Checkpoint) {
+	b.PutString(SaveHeader)
+	b.PutUint16(SaveVersion)
+
+	b.PutString(c.World.Name)
+	b.PutInt64(c.World.Seed)
+	b.PutFloat64(c.World.SpawnRate)
+	putTimer(b, c.Spawning)
+	b.PutInt(c.Ticks)
+	b.PutInt(c.Player)
+	b.PutInt(c.TotalScore)
+	b.PutUint64(c.Source.State)
+
+	b.PutUint32(uint32(len(c.Tanks.vec)))
+	for i := range c.Tanks.vec {
+		cp := &c.Tanks.vec[i]
+		b.PutBool(cp.occupied)
+		if cp.occupied {
+			w.WriteTank(b, &cp.value)
+		}
+	}
+
+	b.PutUint32(uint32(len(c.Bullets.vec)))
+	for i := range c.Bullets.vec {
+		cp := &c.Bullets.vec[i]
+		b.PutBool(cp.occupied)
+		if cp.occupied {
+			w.WriteBullet(b, &cp.value)
+		}
+	}
+
+	b.PutUint32(uint32(len(c.Hasher.Nodes)))
+	for _, n := range c.Hasher.Nodes {
+		b.PutUint32(uint32(len(n.Groups)))
+		for _, g := range n.Groups {
+			b.PutInt(g.ID)
+			b.PutInt(g.Idx)
+			b.PutInt(g.Len)
+		}
+		b.PutUint32(uint32(len(n.Ints)))
+		for _, id := range n.Ints {
+			b.PutInt(id)
+		}
+	}
+}
+
+// ReadCheckpoint reads checkpoint written by WriteCheckpoint
+func (w *World) ReadCheckpoint(b *netw.Buffer) (c *Checkpoint, err error) {
+	defer func() {
+		// binding.S panics on length mismatch
+		if rec := recover(); rec != nil {
+			err = ErrSaveCorrupt.Wrap(fmt.Errorf("%v", rec))
+		}
+	}()
+
+	if b.String() != SaveHeader {
+		return nil, ErrSaveHeader
+	}
+	if v := b.Uint16(); v != SaveVersion {
+		return nil, ErrSaveVersion.Args(v, SaveVersion)
+	}
+
+	c = &Checkpoint{}
+
+	name := b.String()
+	world, _, ok := w.Assets.Worlds.World(name)
+	if !ok {
+		return nil, ErrSaveWorld.Args(name)
+	}
+	c.World = *world
+	c.World.Seed = b.Int64()
+	c.World.SpawnRate = b.Float64()
+	c.Spawning = readTimer(b)
+	// only singleplayer can be saved, game is paused when saving
+	c.GameState = Singleplayer
+	c.Ticks = b.Int()
+	c.Player = b.Int()
+	c.TotalScore = b.Int()
+	c.Source.State = b.Uint64()
+
+	c.Tanks.vec = make([]TankCapsule, readLen(b))
+	for i := range c.Tanks.vec {
+		cp := &c.Tanks.vec[i]
+		cp.occupied = b.Bool()
+		if cp.occupied {
+			c.Tanks.count++
+			err = w.ReadTank(b, &cp.value)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			c.Tanks.freeIDs = append(c.Tanks.freeIDs, i)
+		}
+	}
+	c.Tanks.outdated = true
+
+	c.Bullets.vec = make([]BulletCapsule, readLen(b))
+	for i := range c.Bullets.vec {
+		cp := &c.Bullets.vec[i]
+		cp.occupied = b.Bool()
+		if cp.occupied {
+			c.Bullets.count++
+			err = w.ReadBullet(b, &cp.value)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			c.Bullets.freeIDs = append(c.Bullets.freeIDs, i)
+		}
+	}
+	c.Bullets.outdated = true
+
+	size := c.World.Size.Div(c.World.Tile).Point()
+	c.Hasher = spatial.NMinHash(size.X, size.Y, c.World.Tile)
+	if readLen(b) != len(c.Hasher.Nodes) {
+		return nil, ErrSaveCorrupt
+	}
+	for i := range c.Hasher.Nodes {
+		n := &c.Hasher.Nodes[i]
+		n.Groups = make([]spatial.IntGroup, readLen(b))
+		for j := range n.Groups {
+			n.Groups[j] = spatial.IntGroup{ID: b.Int(), Idx: b.Int(), Len: b.Int()}
+		}
+		n.Ints = make([]int, readLen(b))
+		for j := range n.Ints {
+			n.Ints[j] = b.Int()
+		}
+	}
+
+	if b.Failed {
+		return nil, ErrSaveCorrupt
+	}
+
+	return c, nil
+}
+
+// WriteTank writes runtime state of tank, asset is saved by name
+func (w *World) WriteTank(b *netw.Buffer, t *Tank) {
+	b.PutString(t.Tank.Name)
+	b.PutVec(t.Pos)
+	b.PutVec(t.Vel)
+	b.PutVec(t.Aim)
+	b.PutFloat64(t.BaseRot)
+	b.PutInt(len(t.Guns))
+	for _, g := range t.Guns {
+		b.PutFloat64(g.Rot)
+		putTimer(b, g.Reloader)
+		b.PutVec(g.Aim)
+		b.PutInt(g.Target)
+		b.PutBool(g.Fire)
+		b.PutInt(g.Volleys)
+		putTimer(b, g.Burst)
+	}
+	b.PutInt(t.Health)
+	b.PutString(t.Name)
+	t.Input.Write(b)
+	b.PutBool(t.Player)
+	b.PutInt(t.Client)
+	b.PutInt(t.Address.X)
+	b.PutInt(t.Address.Y)
+	b.PutInt(t.Group)
+	b.PutInt(t.ID)
+	b.PutInt(t.Target)
+	b.PutInt(t.Score)
+	putTimer(b, t.Healing)
+	b.PutFloat64(t.Mask.R)
+	b.PutFloat64(t.Mask.G)
+	b.PutFloat64(t.Mask.B)
+	b.PutFloat64(t.Mask.A)
+	putInterpolator(b, t.HitInter)
+	putInterpolator(b, t.HealInter)
+	putInterpolator(b, t.BarInter)
+
+	b.PutUint32(uint32(len(t.Path.Points)))
+	for _, p := range t.Path.Points {
+		b.PutVec(p)
+	}
+	b.PutVec(t.Path.Goal)
+	b.PutInt(t.Path.Next)
+	b.PutInt(t.Path.Target)
+}
+
+// ReadTank reads tank written by WriteTank
+func (w *World) ReadTank(b *netw.Buffer, t *Tank) error {
+	name := b.String()
+	tank, _, ok := w.Assets.Tanks.Tank(name)
+	if !ok {
+		return ErrSaveTank.Args(name)
+	}
+
+	t.Tank = tank
+	t.BaseSprite = tank.BaseSprite
+	t.InitGuns(0)
+	t.Path.Reset()
+
+	t.Pos = b.Vec()
+	t.Vel = b.Vec()
+	t.Aim = b.Vec()
+	t.BaseRot = b.Float64()
+	if l := b.Int(); l != len(t.Guns) {
+		return ErrSaveCorrupt
+	}
+	for i := range t.Guns {
+		g := &t.Guns[i]
+		g.Rot = b.Float64()
+		g.Reloader = readTimer(b)
+		g.Aim = b.Vec()
+		g.Target = b.Int()
+		g.Fire = b.Bool()
+		g.Volleys = b.Int()
+		g.Burst = readTimer(b)
+	}
+	t.Health = b.Int()
+	t.Name = b.String()
+	t.Input = Bindings.Clone()
+	t.Input.Read(b)
+	t.Player = b.Bool()
+	t.Client = b.Int()
+	t.Address = mat.P(b.Int(), b.Int())
+	t.Group = b.Int()
+	t.ID = b.Int()
+	t.Target = b.Int()
+	t.Score = b.Int()
+	t.Healing = readTimer(b)
+	t.Mask = mat.RGBA{R: b.Float64(), G: b.Float64(), B: b.Float64(), A: b.Float64()}
+	t.HitInter = readInterpolator(b)
+	t.HealInter = readInterpolator(b)
+	t.BarInter = readInterpolator(b)
+
+	t.Path.Points = make([]mat.Vec, readLen(b))
+	for i := range t.Path.Points {
+		t.Path.Points[i] = b.Vec()
+	}
+	t.Path.Goal = b.Vec()
+	t.Path.Next = b.Int()
+	t.Path.Target = b.Int()
+
+	return nil
+}
+
+// WriteBullet writes runtime state of bullet, asset is saved as name of tank
+// and index of turret that fires it
+func (w *World) WriteBullet(b *netw.Buffer, bl *Bullet) {
+	name, turret := w.BulletTank(bl.Bullet)
+	b.PutString(name)
+	b.PutInt(turret)
+	b.PutVec(bl.Pos)
+	b.PutFloat64(bl.Rot)
+	b.PutFloat64(bl.Speed)
+	putTimer(b, bl.Live)
+	b.PutInt(bl.Group)
+	b.PutInt(bl.ID)
+	b.PutInt(bl.Owner)
+	b.PutInt(bl.Rewind)
+}
+
+// ReadBullet reads bullet written by WriteBullet
+func (w *World) ReadBullet(b *netw.Buffer, bl *Bullet) error {
+	name, turret := b.String(), b.Int()
+	tank, _, ok := w.Assets.Tanks.Tank(name)
+	if !ok {
+		return ErrSaveTank.Args(name)
+	}
+	if turret < 0 || turret >= len(tank.Turrets) {
+		return ErrSaveTurret.Args(name, turret)
+	}
+
+	bl.Bullet = &tank.Turrets[turret].Bullet
+	bl.Sprite = bl.Bullet.Sprite
+	bl.Pos = b.Vec()
+	bl.Rot = b.Float64()
+	bl.Speed = b.Float64()
+	bl.Live = readTimer(b)
+	bl.Group = b.Int()
+	bl.ID = b.Int()
+	bl.Owner = b.Int()
+	bl.Rewind = b.Int()
+
+	return nil
+}
+
+// BulletTank returns name of tank and index of turret the bullet belongs to,
+// bullets are stored inside turret definitions
+func (w *World) BulletTank(bullet *assets.Bullet) (string, int) {
+	for _, t := range w.Assets.Tanks.Slice() {
+		for i := range t.V.Turrets {
+			if &t.V.Turrets[i].Bullet == bullet {
+				return t.K, i
+			}
+		}
+	}
+	return "", -1
+}
+
+func putTimer(b *netw.Buffer, t timer.Timer) {
+	b.PutFloat64(t.Progress)
+	b.PutFloat64(t.Period)
+}
+
+func readTimer(b *netw.Buffer) timer.Timer {
+	return timer.Progress(b.Float64(), b.Float64())
+}
+
+func putInterpolator(b *netw.Buffer, i Interpolator) {
+	b.PutFloat64(i.Start)
+	b.PutFloat64(i.End)
+	putTimer(b, i.Timer)
+}
+
+func readInterpolator(b *netw.Buffer) (i Interpolator) {
+	i.Start = b.Float64()
+	i.End = b.Float64()
+	i.Timer = readTimer(b)
+	return
+}
@@ -0,0 +1,58 @@
+package game
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+)
+
+// checkpoint returns encoded checkpoint of world
+func checkpoint(w *World) []byte {
+	var b netw.Buffer
+	w.WriteCheckpoint(&b, w.Capture())
+	return b.Data
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	w := testWorld(t, "medium", 7)
+	simulate(w, 900)
+	saved := checkpoint(w)
+
+	c, err := w.ReadCheckpoint(&netw.Buffer{Data: saved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NHeadlessWorld(w.Assets)
+	world, _, _ := l.Assets.Worlds.World(c.World.Name)
+	l.LoadMapSeed(Singleplayer, world, c.World.Seed)
+	l.Restore(c)
+
+	if !bytes.Equal(checkpoint(l), saved) {
+		t.Fatal("loaded match differs from saved one")
+	}
+	if l.Tanks.Count() < 2 {
+		t.Fatal("match is too empty to test saving")
+	}
+
+	for i := 0; i < 10; i++ {
+		simulate(w, 60)
+		simulate(l, 60)
+		if !bytes.Equal(checkpoint(l), checkpoint(w)) {
+			t.Fatalf("loaded match diverged at tick %d", w.Ticks)
+		}
+	}
+	sameState(t, w, l)
+}
+
+func TestCheckpointCorrupt(t *testing.T) {
+	w := testWorld(t, "medium", 7)
+	simulate(w, 300)
+	saved := checkpoint(w)
+
+	for i := 0; i < len(saved); i += 7 {
+		if _, err := w.ReadCheckpoint(&netw.Buffer{Data: saved[:i]}); err == nil {
+			t.Fatalf("checkpoint cut to %d of %d bytes was accepted", i, len(saved))
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package game
+
+import (
+	"github.com/jakubDoka/mlok/logic/spatial"
+	"github.com/jakubDoka/mlok/logic/timer"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// Source is rand.Source64 (splitmix64) with state that can be copied, unlike
+// the one from math/rand, so world can be captured and restored
+type Source struct {
+	State uint64
+}
+
+// Seed implements rand.Source
+func (s *Source) Seed(seed int64) {
+	s.State = uint64(seed)
+}
+
+// Uint64 implements rand.Source64
+func (s *Source) Uint64() uint64 {
+	s.State += 0x9e3779b97f4a7c15
+	z := s.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 implements rand.Source
+func (s *Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Checkpoint is independent copy of simulation state, restoring it puts world
+// back to the tick it was captured in
+type Checkpoint struct {
+	World              assets.World
+	Spawning           timer.Timer
+	GameState          State
+	Ticks              int
+	Player, TotalScore int
+	Source             Source
+	Tanks              TankStorage
+	Bullets            BulletStorage
+	Hasher             spatial.MinHash
+}
+
+// Capture copies current simulation state
+func (w *World) Capture() *Checkpoint {
+	return &Checkpoint{
+		World:      w.World,
+		Spawning:   w.Spawning,
+		GameState:  w.GameState,
+		Ticks:      w.Ticks,
+		Player:     w.Player,
+		TotalScore: w.TotalScore,
+		Source:     w.Source,
+		Tanks:      w.Tanks.Copy(),
+		Bullets:    w.Bullets.Copy(),
+		Hasher:     CopyHash(w.Hasher),
+	}
+}
+
+// Restore puts world to state of checkpoint, checkpoint stays untouched so it can
+// be restored multiple times
+func (w *World) Restore(c *Checkpoint) {
+	w.World = c.World
+	w.Spawning = c.Spawning
+	w.GameState = c.GameState
+	w.Ticks = c.Ticks
+	w.Player = c.Player
+	w.TotalScore = c.TotalScore
+	w.Source = c.Source
+	w.Tanks = c.Tanks.Copy()
+	w.Bullets = c.Bullets.Copy()
+	w.Hasher = CopyHash(c.Hasher)
+	w.Accumulated = 0
+}
+
+// Copy returns independent copy of storage
+func (s *TankStorage) Copy() TankStorage {
+	c := TankStorage{
+		vec:      append([]TankCapsule(nil), s.vec...),
+		freeIDs:  s.freeIDs.Clone(),
+		occupied: append([]int(nil), s.occupied...),
+		count:    s.count,
+		outdated: s.outdated,
+	}
+
+	for i := range c.vec {
+		t := &c.vec[i].value
+		t.Input = t.Input.Clone()
+		t.Guns = append([]Gun(nil), t.Guns...)
+		t.Path.Points = append([]mat.Vec(nil), t.Path.Points...)
+	}
+
+	return c
+}
+
+// Place allocates tank under given id, storage grows if needed, nil is returned
+// if id is invalid or already used
+func (s *TankStorage) Place(id int) *Tank {
+	if id < 0 {
+		return nil
+	}
+	for len(s.vec) <= id {
+		s.Blanc()
+	}
+
+	t := s.AllocateID(id)
+	if t == nil {
+		return nil
+	}
+	s.vec[id].occupied = true
+	s.count++
+	s.outdated = true
+
+	return t
+}
+
+// Copy returns independent copy of storage
+func (s *BulletStorage) Copy() BulletStorage {
+	return BulletStorage{
+		vec:      append([]BulletCapsule(nil), s.vec...),
+		freeIDs:  s.freeIDs.Clone(),
+		occupied: append([]int(nil), s.occupied...),
+		count:    s.count,
+		outdated: s.outdated,
+	}
+}
+
+// Place allocates bullet under given id, storage grows if needed, nil is returned
+// if id is invalid or already used
+func (s *BulletStorage) Place(id int) *Bullet {
+	if id < 0 {
+		return nil
+	}
+	for len(s.vec) <= id {
+		s.Blanc()
+	}
+
+	b := s.AllocateID(id)
+	if b == nil {
+		return nil
+	}
+	s.vec[id].occupied = true
+	s.count++
+	s.outdated = true
+
+	return b
+}
+
+// CopyHash returns independent copy of hasher, order of ids in nodes is preserved
+// so queries return same results
+func CopyHash(h spatial.MinHash) spatial.MinHash {
+	nodes := make([]spatial.IntNode, len(h.Nodes))
+	for i, n := range h.Nodes {
+		nodes[i] = spatial.IntNode{
+			Groups: append([]spatial.IntGroup(nil), n.Groups...),
+			Ints:   append([]int(nil), n.Ints...),
+		}
+	}
+	h.Nodes = nodes
+	return h
+}
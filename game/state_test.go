@@ -0,0 +1,88 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func simulate(w *World, ticks int) {
+	for i := 0; i < ticks; i++ {
+		w.Simulate(w.Step)
+	}
+}
+
+func TestSimulateDeterministic(t *testing.T) {
+	a, b := testWorld(t, "medium", 42), testWorld(t, "medium", 42)
+	for i := 0; i < 20; i++ {
+		simulate(a, 60)
+		simulate(b, 60)
+		if !reflect.DeepEqual(CopyHash(a.Hasher), CopyHash(b.Hasher)) {
+			t.Fatalf("hashers differ at tick %d", a.Ticks)
+		}
+		sameState(t, a, b)
+	}
+
+	c := testWorld(t, "medium", 43)
+	simulate(c, a.Ticks)
+	if reflect.DeepEqual(a.Capture(), c.Capture()) {
+		t.Fatal("different seeds produced same match")
+	}
+}
+
+func TestCaptureRestore(t *testing.T) {
+	w := testWorld(t, "medium", 7)
+	simulate(w, 900)
+
+	cp := w.Capture()
+	saved := w.Capture()
+	simulate(w, 300)
+	after := w.Capture()
+
+	w.Restore(cp)
+	if !reflect.DeepEqual(cp, saved) {
+		t.Fatal("simulation modified captured checkpoint")
+	}
+	simulate(w, 300)
+	if !reflect.DeepEqual(w.Capture(), after) {
+		t.Fatal("restored world diverged")
+	}
+
+	// checkpoint can be restored repeatedly
+	w.Restore(cp)
+	if !reflect.DeepEqual(w.Capture(), saved) {
+		t.Fatal("restore does not reproduce captured state")
+	}
+}
+
+func TestAdvanceUnevenFrames(t *testing.T) {
+	even, uneven := testWorld(t, "hard", 1), testWorld(t, "hard", 1)
+	// binary fractions so accumulated time is exact
+	even.Step, uneven.Step = 1./64, 1./64
+
+	for i := 0; i < 300; i++ {
+		even.Advance(1. / 64)
+		even.Advance(1. / 64)
+
+		uneven.Advance(1. / 128)
+		uneven.Advance(3. / 128)
+
+		if even.Ticks != 2*(i+1) || uneven.Ticks != even.Ticks {
+			t.Fatalf("frame %d: expected %d ticks, got %d and %d", i, 2*(i+1), even.Ticks, uneven.Ticks)
+		}
+	}
+
+	sameState(t, even, uneven)
+	if even.Tanks.Count() < 2 {
+		t.Fatal("nothing spawned, test does not exercise simulation")
+	}
+}
+
+func TestAdvanceClampsSpikes(t *testing.T) {
+	w := testWorld(t, "hard", 1)
+	w.Step = 1. / 64
+
+	w.Advance(10)
+	if w.Ticks != 6 {
+		t.Fatalf("spike should be clamped to 6 ticks, got %d", w.Ticks)
+	}
+}
@@ -0,0 +1,350 @@
+package game
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/sterr"
+)
+
+// MaxFrame is size of the largest message tcp connection accepts, length
+// prefix is checked before anything is allocated
+const MaxFrame = 1 << 22
+
+// LagBacklog is amount of queued messages after which simulated congestion
+// drops unreliable ones
+const LagBacklog = 256
+
+var (
+	ErrTransport = sterr.New("unknown transport %q, available are tcp and udp")
+	ErrFrameSize = sterr.New("message of %d bytes exceeds limit of %d bytes")
+)
+
+// Conn is connection of any transport, it carries whole messages
+type Conn interface {
+	// Inbox delivers received messages, it is closed once connection ends
+	Inbox() <-chan netw.Buffer
+	// Send sends message, reliable messages arrive exactly once and in order,
+	// others can get lost, data can be reused after Send returns
+	Send(data []byte, reliable bool)
+	// Err is the reason connection ended, it is valid once Inbox is closed
+	Err() error
+	RemoteAddr() net.Addr
+	Close()
+}
+
+// Listener accepts connections of transport
+type Listener interface {
+	Accept() (Conn, error)
+	Port() int
+	Close()
+}
+
+// Transport creates connections, TCP and UDP are swappable
+type Transport interface {
+	Name() string
+	Listen(port int) (Listener, error)
+	Dial(addr string, timeout time.Duration) (Conn, error)
+}
+
+// Transports are all transports by name, name is also address scheme
+var Transports = map[string]Transport{
+	"tcp": TCP{},
+	"udp": UDP{},
+}
+
+// TransportOf returns transport with name, empty name means tcp
+func TransportOf(name string) (Transport, error) {
+	if name == "" {
+		return TCP{}, nil
+	}
+	t, ok := Transports[name]
+	if !ok {
+		return nil, ErrTransport.Args(name)
+	}
+	return t, nil
+}
+
+// SplitScheme splits address like 'udp://host:port' to transport and rest,
+// address without scheme uses tcp
+func SplitScheme(addr string) (Transport, string, error) {
+	i := strings.Index(addr, "://")
+	if i < 0 {
+		return TCP{}, addr, nil
+	}
+	t, err := TransportOf(addr[:i])
+	return t, addr[i+3:], err
+}
+
+// JoinScheme is inverse of SplitScheme, tcp addresses stay without scheme
+func JoinScheme(t Transport, addr string) string {
+	if t.Name() == "tcp" {
+		return addr
+	}
+	return t.Name() + "://" + addr
+}
+
+// TCP is stream transport, all messages are reliable so lost snapshot holds
+// back the ones after it
+type TCP struct{}
+
+// Name implements Transport interface
+func (TCP) Name() string {
+	return "tcp"
+}
+
+// Listen implements Transport interface
+func (TCP) Listen(port int) (Listener, error) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	return &tcpListener{l}, nil
+}
+
+// Dial implements Transport interface
+func (TCP) Dial(addr string, timeout time.Duration) (Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return nTCPConn(conn.(*net.TCPConn)), nil
+}
+
+type tcpListener struct {
+	*net.TCPListener
+}
+
+func (l *tcpListener) Accept() (Conn, error) {
+	conn, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	return nTCPConn(conn), nil
+}
+
+func (l *tcpListener) Port() int {
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (l *tcpListener) Close() {
+	l.TCPListener.Close()
+}
+
+// tcpConn is framed tcp connection, messages are prefixed by their length
+// the same way netw.Writer does it
+type tcpConn struct {
+	conn   *net.TCPConn
+	inbox  chan netw.Buffer
+	done   chan struct{}
+	once   sync.Once
+	err    error
+	writer netw.Writer
+}
+
+func nTCPConn(conn *net.TCPConn) *tcpConn {
+	conn.SetNoDelay(true)
+	c := &tcpConn{
+		conn:  conn,
+		inbox: make(chan netw.Buffer, 64),
+		done:  make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+// read passes messages to inbox until connection fails or is closed, closed
+// connection does not wait for inbox to be drained
+func (c *tcpConn) read() {
+	defer close(c.inbox)
+
+	r := bufio.NewReader(c.conn)
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			c.err = err
+			return
+		}
+		n := binary.LittleEndian.Uint32(size[:])
+		if n > MaxFrame {
+			c.err = ErrFrameSize.Args(n, MaxFrame)
+			c.conn.Close()
+			return
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			c.err = err
+			return
+		}
+
+		select {
+		case c.inbox <- netw.Buffer{Data: data}:
+		case <-c.done:
+			c.err = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (c *tcpConn) Inbox() <-chan netw.Buffer {
+	return c.inbox
+}
+
+// Send cannot stall the caller for longer then WriteTimeout, failed connection
+// is closed and Inbox will be closed soon after
+func (c *tcpConn) Send(data []byte, reliable bool) {
+	c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	_, err := c.writer.Write(c.conn, data)
+	if err != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *tcpConn) Err() error {
+	return c.err
+}
+
+func (c *tcpConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *tcpConn) Close() {
+	c.once.Do(func() { close(c.done) })
+	c.conn.Close()
+}
+
+type delayed struct {
+	due      time.Time
+	data     []byte
+	reliable bool
+}
+
+// lagConn delays and drops messages of wrapped connection
+type lagConn struct {
+	Conn
+	lag   *Lag
+	inbox chan netw.Buffer
+	in    chan delayed
+	done  chan struct{}
+	once  sync.Once
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	out      []delayed
+	closed   bool
+	lastSend time.Time
+}
+
+// NLagConn makes conn behave like a bad network
+func NLagConn(conn Conn, lag *Lag) Conn {
+	c := &lagConn{
+		Conn:  conn,
+		lag:   lag,
+		inbox: make(chan netw.Buffer, 64),
+		in:    make(chan delayed, 256),
+		done:  make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+
+	go c.read()
+	go c.deliver()
+	go c.write()
+
+	return c
+}
+
+func (c *lagConn) read() {
+	defer close(c.in)
+	var last time.Time
+	for b := range c.Conn.Inbox() {
+		if c.lag.Drop(b.Data) {
+			continue
+		}
+		last = due(last, c.lag)
+		select {
+		case c.in <- delayed{last, b.Data, true}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// deliver passes delayed incoming messages to Inbox
+func (c *lagConn) deliver() {
+	defer close(c.inbox)
+	cl := c.lag.clock()
+	for d := range c.in {
+		cl.Sleep(d.due.Sub(cl.Now()))
+		select {
+		case c.inbox <- netw.Buffer{Data: d.data}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write sends delayed outgoing messages
+func (c *lagConn) write() {
+	cl := c.lag.clock()
+	for {
+		c.mu.Lock()
+		for len(c.out) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		d := c.out[0]
+		c.out = c.out[1:]
+		c.mu.Unlock()
+
+		cl.Sleep(d.due.Sub(cl.Now()))
+		c.Conn.Send(d.data, d.reliable)
+	}
+}
+
+func (c *lagConn) Inbox() <-chan netw.Buffer {
+	return c.inbox
+}
+
+// Send queues the message, reliable messages are never lost, unreliable are
+// dropped once LagBacklog messages wait for sending
+func (c *lagConn) Send(data []byte, reliable bool) {
+	if c.lag.Drop(data) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || (!reliable && len(c.out) >= LagBacklog) {
+		return
+	}
+	c.lastSend = due(c.lastSend, c.lag)
+	c.out = append(c.out, delayed{c.lastSend, append([]byte(nil), data...), reliable})
+	c.cond.Signal()
+}
+
+func (c *lagConn) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Signal()
+	c.mu.Unlock()
+
+	c.once.Do(func() { close(c.done) })
+	c.Conn.Close()
+}
+
+func due(last time.Time, lag *Lag) time.Time {
+	t := lag.clock().Now().Add(lag.Delay())
+	if t.Before(last) {
+		return last
+	}
+	return t
+}
@@ -0,0 +1,223 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+)
+
+// pair returns connected ends of transport on loopback
+func pair(t *testing.T, tr Transport) (server, client Conn, l Listener) {
+	t.Helper()
+	l, err := tr.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+
+	client, err = tr.Dial("127.0.0.1:"+strconv.Itoa(l.Port()), time.Second)
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	// udp listener learns about connection from first packet
+	client.Send([]byte{0, 0}, true)
+
+	select {
+	case server = <-accepted:
+	case <-time.After(2 * time.Second):
+	}
+	if server == nil {
+		client.Close()
+		l.Close()
+		t.Fatal("connection was not accepted")
+	}
+	if b := receive(t, server); !bytes.Equal(b.Data, []byte{0, 0}) {
+		t.Fatalf("unexpected first message %v", b.Data)
+	}
+
+	return
+}
+
+// receive waits for next message of connection
+func receive(t *testing.T, c Conn) netw.Buffer {
+	t.Helper()
+	select {
+	case b, ok := <-c.Inbox():
+		if !ok {
+			t.Fatalf("connection ended: %v", c.Err())
+		}
+		return b
+	case <-time.After(2 * time.Second):
+		t.Fatal("message did not arrive")
+	}
+	return netw.Buffer{}
+}
+
+// closed waits for inbox of connection to be closed and returns its error
+func closed(t *testing.T, c Conn) error {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-c.Inbox():
+			if !ok {
+				return c.Err()
+			}
+		case <-timeout:
+			t.Fatal("connection did not end")
+		}
+	}
+}
+
+func TestTransportLoopback(t *testing.T) {
+	for name, tr := range Transports {
+		t.Run(name, func(t *testing.T) {
+			server, client, l := pair(t, tr)
+			defer l.Close()
+			defer server.Close()
+			defer client.Close()
+
+			for i := 0; i < 100; i++ {
+				msg := []byte("message " + strconv.Itoa(i))
+				client.Send(msg, true)
+				server.Send(msg, true)
+				if b := receive(t, server); !bytes.Equal(b.Data, msg) {
+					t.Fatalf("server got %q, expected %q", b.Data, msg)
+				}
+				if b := receive(t, client); !bytes.Equal(b.Data, msg) {
+					t.Fatalf("client got %q, expected %q", b.Data, msg)
+				}
+			}
+
+			client.Close()
+			closed(t, server)
+		})
+	}
+}
+
+func TestTCPFrameLimit(t *testing.T) {
+	l, err := TCP{}.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	raw, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(l.Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], MaxFrame+1)
+	raw.Write(size[:])
+
+	if err := closed(t, server); !ErrFrameSize.SameSurface(err) {
+		t.Fatalf("expected frame size error, got %v", err)
+	}
+}
+
+func TestTCPCloseWithFullInbox(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	server, client, l := pair(t, TCP{})
+	// nobody reads server inbox, reader gets stuck on full channel
+	for i := 0; i < 200; i++ {
+		client.Send([]byte{1, 0}, true)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	server.Close()
+	client.Close()
+	l.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines leaked", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLagConnKeepsReliable(t *testing.T) {
+	server, client, l := pair(t, TCP{})
+	defer l.Close()
+	defer server.Close()
+
+	clock := NFakeClock(time.Now())
+	lag := NLagConn(client, &Lag{Latency: 50 * time.Millisecond, Clock: clock})
+
+	// more than backlog, congestion must not drop any of them
+	const count = LagBacklog * 4
+	for i := 0; i < count; i++ {
+		lag.Send([]byte("message "+strconv.Itoa(i)), true)
+	}
+	clock.Advance(time.Second)
+
+	for i := 0; i < count; i++ {
+		msg := []byte("message " + strconv.Itoa(i))
+		if b := receive(t, server); !bytes.Equal(b.Data, msg) {
+			t.Fatalf("got %q, expected %q", b.Data, msg)
+		}
+	}
+
+	lag.Close()
+	lag.Send([]byte("late"), true)
+	lag.Close()
+	closed(t, server)
+}
+
+func TestUDPFragments(t *testing.T) {
+	server, client, l := pair(t, UDP{})
+	defer l.Close()
+	defer server.Close()
+	defer client.Close()
+
+	for _, c := range []struct {
+		size     int
+		reliable bool
+	}{
+		{3*MaxPacket + 17, false},
+		{64 * MaxPacket, false},
+		{2 * MaxPacket, true},
+		{MaxPacket + 1, true},
+		{0, true},
+	} {
+		msg := make([]byte, c.size)
+		for i := range msg {
+			msg[i] = byte(i * 7)
+		}
+		client.Send(msg, c.reliable)
+		if b := receive(t, server); !bytes.Equal(b.Data, msg) {
+			t.Fatalf("message of %d bytes arrived with %d bytes", c.size, len(b.Data))
+		}
+	}
+
+	client.Send(make([]byte, MaxFrame+1), false)
+	if err := closed(t, client); !ErrUDPTooLarge.SameSurface(err) {
+		t.Fatalf("expected size error, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package game
+
+import (
+	"math"
+
+	"github.com/jakubDoka/mlok/ggl"
+	"github.com/jakubDoka/mlok/logic/ai"
+	"github.com/jakubDoka/mlok/logic/timer"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/mlok/mat/angle"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// MaxTurrets is the most turrets of one tank snapshot accepts, it only guards
+// against corrupted messages
+const MaxTurrets = 1024
+
+// Gun is runtime state of tank turret, Rot is relative to tank base, AI
+// guns have their own Target and Aim and shoot when Fire is true
+type Gun struct {
+	*assets.Turret
+	Rot      float64
+	Reloader timer.Timer
+	Aim      mat.Vec
+	Target   int
+	Fire     bool
+	Sprite   ggl.Sprite
+	// Volleys is how many volleys of current burst are left, Burst times
+	// them
+	Volleys int
+	Burst   timer.Timer
+}
+
+// Init sets gun to fresh state of given turret
+func (g *Gun) Init(turret *assets.Turret) {
+	g.Turret = turret
+	g.Rot = turret.Rot
+	g.Reloader = timer.Period(turret.ReloadSpeed)
+	g.Target = -1
+	g.Fire = false
+	g.Volleys = 0
+	g.Burst = timer.Period(turret.Bullet.BurstDelay)
+	g.Sprite = turret.Sprite
+	g.Sprite.SetPivot(turret.Pivot)
+}
+
+// Pos returns position of turret on tank
+func (g *Gun) Pos(t *Tank) mat.Vec {
+	return t.Pos.Add(g.Offset.Rotated(t.BaseRot))
+}
+
+// Limit keeps rotation in the firing arc of turret
+func (g *Gun) Limit(rot float64) float64 {
+	if g.Arc == 0 {
+		return rot
+	}
+	d := angle.To(angle.Norm(g.Turret.Rot), angle.Norm(rot))
+	return g.Turret.Rot + mat.Clamp(d, -g.Arc, g.Arc)
+}
+
+// InArc returns whether gun can turn to the world angle
+func (g *Gun) InArc(t *Tank, dir float64) bool {
+	if g.Arc == 0 {
+		return true
+	}
+	return math.Abs(angle.To(angle.Norm(t.BaseRot+g.Turret.Rot), angle.Norm(dir))) <= g.Arc
+}
+
+// InitGuns creates guns for all turrets of tank, rot is rotation of turrets
+// that can turn all around
+func (t *Tank) InitGuns(rot float64) {
+	t.Guns = t.Guns[:0]
+	for i := range t.Turrets {
+		var g Gun
+		g.Init(&t.Turrets[i])
+		if g.Arc == 0 {
+			g.Rot = rot
+		}
+		t.Guns = append(t.Guns, g)
+	}
+}
+
+// TurretRot returns rotation of the first turret
+func (t *Tank) TurretRot() float64 {
+	if len(t.Guns) == 0 {
+		return 0
+	}
+	return t.Guns[0].Rot
+}
+
+// ControlGuns turns guns to their aim and fires the ones that should, player
+// guns all follow tank Aim and fire on Shoot
+func (w *World) ControlGuns(t *Tank) {
+	for i := range t.Guns {
+		g := &t.Guns[i]
+		aim, fire := g.Aim, g.Fire
+		if t.Player {
+			aim, fire = t.Aim, t.Input.Pressed(Shoot)
+		}
+
+		pos := g.Pos(t)
+		total := g.Rot + t.BaseRot
+		g.Rot = g.Limit(angle.Turn(angle.Norm(total), pos.To(aim).Angle(), g.TurnSpeed*w.Delta) - t.BaseRot)
+
+		if w.Predicting {
+			continue
+		}
+		if g.Volleys != 0 {
+			if g.Burst.DoneReset() {
+				w.Volley(t, g, pos, total)
+				g.Volleys--
+			}
+		} else if fire && g.Reloader.DoneReset() {
+			w.Volley(t, g, pos, total)
+			g.Volleys = mat.Maxi(g.Bullet.Burst, 1) - 1
+			g.Burst.Reset()
+		}
+	}
+}
+
+// Volley fires bullets of one volley of gun, they are spread over Spread of
+// the bullet and their speed differs by up to SpeedVariance
+func (w *World) Volley(t *Tank, g *Gun, pos mat.Vec, dir float64) {
+	bl := &g.Bullet
+	muzzle := pos.Add(mat.Rad(dir, g.Len))
+	count := mat.Maxi(bl.Count, 1)
+	for i := 0; i < count; i++ {
+		rot := dir
+		if count != 1 {
+			rot += bl.Spread * (float64(i)/float64(count-1) - .5)
+		} else if bl.Spread != 0 {
+			rot += bl.Spread * (w.Float64() - .5)
+		}
+
+		b := w.CreateBullet(muzzle, t.Vel, t.Group, t.ID, rot, bl)
+		if bl.SpeedVariance != 0 {
+			b.Speed *= 1 + bl.SpeedVariance*(w.Float64()*2-1)
+		}
+	}
+}
+
+// AimGuns picks target for each AI gun, gun keeps its target while it is in
+// range extended by tank Memory and in the firing arc
+func (w *World) AimGuns(t *Tank) {
+	for i := range t.Guns {
+		g := &t.Guns[i]
+		if g.Target != -1 && !w.CanHit(t, g, g.Target, 1+t.Memory) {
+			g.Target = -1
+		}
+		if g.Target == -1 {
+			pos := g.Pos(t)
+			w.Buff = w.Hasher.Query(mat.Square(pos, g.Bullet.Range()), w.Buff[:0], t.Group, false)
+			dest := math.MaxFloat64
+			for _, id := range w.Buff {
+				if d := pos.To(w.Tanks.Item(id).Pos).Len2(); d < dest && w.CanHit(t, g, id, 1) {
+					g.Target, dest = id, d
+				}
+			}
+		}
+
+		g.Fire = false
+		if g.Target == -1 {
+			continue
+		}
+
+		o := w.Tanks.Item(g.Target)
+		pos := g.Pos(t)
+		var ok bool
+		g.Aim, ok = ai.Predict(pos, o.Pos, o.Vel, g.Bullet.Speed)
+		dif := pos.To(g.Aim)
+		// spread weapons do not need to aim that precisely
+		g.Fire = ok && dif.Len2() <= g.Bullet.Range2() &&
+			math.Abs(angle.To(dif.Angle(), angle.Norm(g.Rot+t.BaseRot))) < math.Abs(math.Atan(o.Size/pos.To(o.Pos).Len()))+g.Bullet.Spread/2
+	}
+
+	if len(t.Guns) != 0 {
+		t.Aim = t.Guns[0].Aim
+	}
+}
+
+// CanHit returns whether target is alive enemy gun can turn to and is in its
+// range scaled by ratio
+func (w *World) CanHit(t *Tank, g *Gun, target int, ratio float64) bool {
+	if !w.Tanks.Used(target) {
+		return false
+	}
+	o := w.Tanks.Item(target)
+	dif := g.Pos(t).To(o.Pos)
+	return !o.Dead() && o.Group != t.Group && dif.Len2() <= g.Bullet.Range2()*ratio && g.InArc(t, dif.Angle())
+}
+
+// DrawGuns draws turrets of tank
+func (w *World) DrawGuns(t *Tank) {
+	for i := range t.Guns {
+		g := &t.Guns[i]
+		g.Sprite.Draw(&w.Batch, mat.M(g.Pos(t), w.Scale, t.BaseRot+g.Rot), t.Mask)
+	}
+}
+
+// BulletIndex returns index of bullet among bullets of all turrets of all
+// tanks, bullets are stored inside turret definitions
+func (w *World) BulletIndex(bullet *assets.Bullet) int {
+	i := 0
+	for _, t := range w.Assets.Tanks.Slice() {
+		for j := range t.V.Turrets {
+			if &t.V.Turrets[j].Bullet == bullet {
+				return i
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// BulletAt returns bullet of given index or nil
+func (w *World) BulletAt(idx int) *assets.Bullet {
+	if idx < 0 {
+		return nil
+	}
+	s := w.Assets.Tanks.Slice()
+	for i := range s {
+		if idx < len(s[i].V.Turrets) {
+			return &s[i].V.Turrets[idx].Bullet
+		}
+		idx -= len(s[i].V.Turrets)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package game
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/mlok/mat/angle"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// gunTank creates tank in group 1 at center of w with own copy of asset,
+// edit gets turret to change, the tank gets copy of it for each rotation
+// in rots, bullets fly straight with range of 500
+func gunTank(w *World, player bool, edit func(tr *assets.Turret), rots ...float64) *Tank {
+	as := w.Assets.Tanks.Slice()[0].V
+	tr := as.Turrets[0]
+	tr.Offset, tr.Len, tr.Arc, tr.TurnSpeed = mat.ZV, 0, 0, 1000
+	tr.Bullet.Speed, tr.Bullet.LiveTime = 500, 1
+	tr.Bullet.Count, tr.Bullet.Spread, tr.Bullet.Burst, tr.Bullet.SpeedVariance = 1, 0, 0, 0
+	edit(&tr)
+	as.Turrets = nil
+	for _, r := range rots {
+		tr.Rot = r
+		as.Turrets = append(as.Turrets, tr)
+	}
+	if len(rots) == 0 {
+		as.Turrets = append(as.Turrets, tr)
+	}
+	return w.CreateTank(player, 0, 1, w.Size.Scaled(.5), 0, 0, &as)
+}
+
+func TestGunArc(t *testing.T) {
+	g := Gun{Turret: &assets.Turret{Rot: math.Pi / 2, Arc: .5}}
+	tk := &Tank{BaseRot: math.Pi / 2}
+	cases := []struct {
+		desc       string
+		rot, limit float64
+		dir        float64
+		in         bool
+	}{
+		{"middle", math.Pi / 2, math.Pi / 2, math.Pi, true},
+		{"edge", math.Pi/2 + .5, math.Pi/2 + .5, math.Pi + .5, true},
+		{"over", math.Pi/2 + 1, math.Pi/2 + .5, math.Pi + 1, false},
+		{"under", math.Pi/2 - 1, math.Pi/2 - .5, math.Pi - 1, false},
+		{"behind", -math.Pi/2 + .1, math.Pi/2 - .5, 0, false},
+		{"across pi", math.Pi/2 + 2*math.Pi + .2, math.Pi/2 + .2, -math.Pi + .2, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			if l := g.Limit(c.rot); math.Abs(angle.To(angle.Norm(l), angle.Norm(c.limit))) > 1e-9 {
+				t.Errorf("Limit(%v) = %v, expected %v", c.rot, l, c.limit)
+			}
+			if g.InArc(tk, c.dir) != c.in {
+				t.Errorf("InArc(%v) = %v, expected %v", c.dir, !c.in, c.in)
+			}
+		})
+	}
+
+	free := Gun{Turret: &assets.Turret{Rot: 1}}
+	if free.Limit(3) != 3 || !free.InArc(tk, -2) {
+		t.Error("turret without arc is limited")
+	}
+}
+
+func TestArcTargets(t *testing.T) {
+	w := emptyWorld(t)
+	// front and back gun, each turns only a bit to the sides
+	tk := gunTank(w, false, func(tr *assets.Turret) {
+		tr.Arc = .5
+	}, 0, math.Pi)
+	pos := tk.Pos
+	front := w.CreateTank(false, 0, 2, pos.Add(mat.V(200, 0)), 0, 0, tk.Tank).ID
+	back := w.CreateTank(false, 0, 2, pos.Add(mat.V(-300, 0)), 0, 0, tk.Tank).ID
+	// closest one is outside of both arcs
+	side := w.CreateTank(false, 0, 2, pos.Add(mat.V(0, 100)), 0, 0, tk.Tank).ID
+	tk = w.Tanks.Item(tk.ID)
+
+	fired := 0
+	for i := 0; i < TickRate*3; i++ {
+		for j := range tk.Guns {
+			tk.Guns[j].Reloader.Tick(w.Delta)
+		}
+		w.AimGuns(tk)
+		if tk.Guns[0].Target != front || tk.Guns[1].Target != back {
+			t.Fatalf("guns target %d and %d, expected %d and %d", tk.Guns[0].Target, tk.Guns[1].Target, front, back)
+		}
+
+		for _, id := range w.Bullets.Occupied() {
+			w.Bullets.Remove(id)
+		}
+		w.ControlGuns(tk)
+		for _, id := range w.Bullets.Occupied() {
+			b := w.Bullets.Item(id)
+			fired++
+			if math.Abs(angle.To(angle.Norm(b.Rot), pos.To(w.Tanks.Item(side).Pos).Angle())) < 1 {
+				t.Fatalf("bullet fired at %v, towards tank outside of arcs", b.Rot)
+			}
+		}
+		for _, g := range tk.Guns {
+			if math.Abs(angle.To(angle.Norm(g.Turret.Rot), angle.Norm(g.Rot))) > g.Arc+1e-9 {
+				t.Fatalf("gun turned to %v, out of its arc", g.Rot)
+			}
+		}
+	}
+	if fired < 4 {
+		t.Fatalf("guns fired only %d times", fired)
+	}
+}
+
+// fired returns bullets created since bullet storage was empty and empties it
+func fired(w *World) (res []Bullet) {
+	for _, id := range w.Bullets.Occupied() {
+		res = append(res, *w.Bullets.Item(id))
+		w.Bullets.Remove(id)
+	}
+	return
+}
+
+func TestVolley(t *testing.T) {
+	cases := []struct {
+		desc          string
+		count         int
+		spread        float64
+		rots          []float64
+		random        bool
+		speedVariance float64
+	}{
+		{"single", 1, 0, []float64{0}, false, 0},
+		{"pellets", 5, 1, []float64{-.5, -.25, 0, .25, .5}, false, 0},
+		{"pair", 2, .4, []float64{-.2, .2}, false, 0},
+		{"zero count", 0, 0, []float64{0}, false, 0},
+		{"random single", 1, 1, nil, true, 0},
+		{"speed variance", 3, 0, []float64{0, 0, 0}, false, .2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			w := emptyWorld(t)
+			tk := gunTank(w, false, func(tr *assets.Turret) {
+				tr.Len = 10
+				tr.Bullet.Count, tr.Bullet.Spread, tr.Bullet.SpeedVariance = c.count, c.spread, c.speedVariance
+			})
+			g := &tk.Guns[0]
+			const dir = .3
+			muzzle := tk.Pos.Add(mat.Rad(dir, 10))
+
+			var rots []float64
+			speeds := map[float64]bool{}
+			for i := 0; i < 20; i++ {
+				w.Volley(tk, g, tk.Pos, dir)
+				bs := fired(w)
+				if c.random {
+					if len(bs) != 1 {
+						t.Fatalf("volley fired %d bullets", len(bs))
+					}
+					if d := bs[0].Rot - dir; math.Abs(d) > c.spread/2 {
+						t.Fatalf("random bullet deviates by %v", d)
+					}
+					rots = append(rots, bs[0].Rot)
+					continue
+				}
+
+				if len(bs) != len(c.rots) {
+					t.Fatalf("volley fired %d bullets, expected %d", len(bs), len(c.rots))
+				}
+				// storage reuses ids in any order
+				sort.Slice(bs, func(i, j int) bool { return bs[i].Rot < bs[j].Rot })
+				for j, b := range bs {
+					if !near(b.Rot, dir+c.rots[j]) {
+						t.Fatalf("bullet %d fired at %v, expected %v", j, b.Rot, dir+c.rots[j])
+					}
+					if !near(b.Pos.X, muzzle.X) || !near(b.Pos.Y, muzzle.Y) {
+						t.Fatalf("bullet starts at %v, muzzle is at %v", b.Pos, muzzle)
+					}
+					if s := g.Bullet.Speed; math.Abs(b.Speed-s) > s*c.speedVariance+1e-9 {
+						t.Fatalf("bullet speed %v differs from %v more than by variance", b.Speed, s)
+					}
+					speeds[b.Speed] = true
+				}
+			}
+
+			if c.random && rots[0] == rots[1] && rots[1] == rots[2] {
+				t.Fatal("single bullet is not spread randomly")
+			}
+			if c.speedVariance != 0 && len(speeds) < 2 || c.speedVariance == 0 && !c.random && len(speeds) != 1 {
+				t.Fatalf("bullets have %d different speeds", len(speeds))
+			}
+		})
+	}
+}
+
+func TestBurst(t *testing.T) {
+	cases := []struct {
+		desc  string
+		burst int
+		hold  bool
+		ticks []int
+	}{
+		{"no burst", 0, true, []int{0, 30}},
+		{"burst", 3, true, []int{0, 6, 12, 30, 36, 42}},
+		{"released trigger", 3, false, []int{0, 6, 12}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			w := emptyWorld(t)
+			// periods end between ticks so float sums do not matter
+			tk := gunTank(w, true, func(tr *assets.Turret) {
+				tr.ReloadSpeed = 29.5 / TickRate
+				tr.Bullet.Burst, tr.Bullet.BurstDelay = c.burst, 5.5/TickRate
+			})
+			g := &tk.Guns[0]
+			g.Reloader.Skip()
+			tk.Aim = tk.Pos.Add(mat.V(100, 0))
+
+			var ticks []int
+			for i := 0; i < 45; i++ {
+				tk.Input[Shoot].State = binding.Released
+				if c.hold || i == 0 {
+					tk.Input[Shoot].State = binding.Pressed
+				}
+				// same order as in StepTank
+				g.Reloader.Tick(w.Delta)
+				g.Burst.Tick(w.Delta)
+				w.ControlGuns(tk)
+				if len(fired(w)) != 0 {
+					ticks = append(ticks, i)
+				}
+			}
+
+			if len(ticks) != len(c.ticks) {
+				t.Fatalf("fired at ticks %v, expected %v", ticks, c.ticks)
+			}
+			for i := range ticks {
+				if ticks[i] != c.ticks[i] {
+					t.Fatalf("fired at ticks %v, expected %v", ticks, c.ticks)
+				}
+			}
+		})
+	}
+}
+
+func TestDistancing(t *testing.T) {
+	cases := []struct {
+		desc     string
+		spread   float64
+		distance float64
+		closer   bool
+	}{
+		// range is 500 and Distancing .5, so tank keeps 250 away
+		{"too close", 0, 200, false},
+		{"far", 0, 300, true},
+		// spread of 1 halves the distance
+		{"spread close", 1, 100, false},
+		{"spread far", 1, 200, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			w := emptyWorld(t)
+			tk := gunTank(w, false, func(tr *assets.Turret) {
+				tr.Bullet.Spread = c.spread
+			})
+			as := *tk.Tank
+			as.Distancing, as.Steer = .5, 1000
+			tk.Tank = &as
+			enemy := w.CreateTank(false, 0, 2, tk.Pos.Add(mat.V(0, c.distance)), 0, 0, &as)
+			tk = w.Tanks.Item(tk.ID)
+
+			w.UpdateAI(tk)
+			if tk.Target != enemy.ID {
+				t.Fatalf("tank targets %d instead of enemy", tk.Target)
+			}
+			if closer := mat.Rad(tk.BaseRot, 1).Dot(tk.Pos.To(enemy.Pos)) > 0; closer != c.closer {
+				t.Fatalf("tank heads to %v, closer is %v, expected %v", tk.BaseRot, closer, c.closer)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package game
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/sterr"
+)
+
+// udp properties
+const (
+	// MaxPacket is maximal size of payload of one packet, it keeps packets
+	// under common MTU so routers do not fragment them, bigger messages are
+	// split into reliable fragments, unreliable ones included so large
+	// snapshots are not lost, messages bigger then MaxFrame close the
+	// connection
+	MaxPacket = 1200 - udpHeader
+	// ResendPeriod is how long reliable message waits for ack before it is
+	// sent again
+	ResendPeriod = 100 * time.Millisecond
+	// KeepAlivePeriod is how long connection can stay quiet before it sends
+	// empty packet, it also carries acks
+	KeepAlivePeriod = 250 * time.Millisecond
+	// ConnTimeout is how long connection waits for any packet before it
+	// gives up on the peer
+	ConnTimeout = 5 * time.Second
+	// MaxUnacked is maximal amount of reliable packets waiting for ack or
+	// for packets before them, peer that cannot keep up is disconnected, it
+	// fits fragments of message of MaxFrame size
+	MaxUnacked = 4096
+)
+
+var (
+	ErrUDPTimeout  = sterr.New("connection timed out")
+	ErrUDPClosed   = sterr.New("connection closed")
+	ErrUDPTooLarge = sterr.New("message of %d bytes exceeds limit of %d bytes")
+	ErrUDPBacklog  = sterr.New("too many unacknowledged messages")
+)
+
+// packet kinds
+const (
+	packetData byte = iota
+	packetPing
+	packetClose
+	// packetFragment is reliable part of message, message ends with
+	// packetData that follows it
+	packetFragment
+)
+
+// packet header: kind uint8, sequence uint32, ack uint32, reliable uint8 and
+// reliable id uint32, payload is the rest of packet
+//
+// Sequence increases with each sent packet, unreliable messages older then
+// the last delivered one are dropped. Ack is id of next reliable message
+// sender expects, all reliable messages before it are acknowledged.
+const udpHeader = 14
+
+// UDP is datagram transport, reliable messages are resent until acknowledged
+// and delivered in order, unreliable ones are delivered only if they are newer
+// then last delivered so late snapshot never replaces fresher one
+type UDP struct{}
+
+// Name implements Transport interface
+func (UDP) Name() string {
+	return "udp"
+}
+
+// Listen implements Transport interface
+func (UDP) Listen(port int) (Listener, error) {
+	sock, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	l := &udpListener{
+		sock:   sock,
+		peers:  map[string]*udpConn{},
+		accept: make(chan Conn, 16),
+	}
+	go l.read()
+
+	return l, nil
+}
+
+// Dial implements Transport interface, udp has no handshake so it does not
+// block, unreachable server is noticed on first message
+func (UDP) Dial(addr string, timeout time.Duration) (Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	sock, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := nUDPConn(sock, raddr, nil)
+	go c.read()
+
+	return c, nil
+}
+
+// udpListener demultiplexes packets of one socket to connections by sender
+// address
+type udpListener struct {
+	sock   *net.UDPConn
+	mu     sync.Mutex
+	peers  map[string]*udpConn
+	accept chan Conn
+	err    error
+}
+
+func (l *udpListener) read() {
+	data := make([]byte, udpHeader+MaxPacket)
+	for {
+		n, from, err := l.sock.ReadFromUDP(data)
+		if err != nil {
+			l.mu.Lock()
+			l.err = err
+			peers := make([]*udpConn, 0, len(l.peers))
+			for _, c := range l.peers {
+				peers = append(peers, c)
+			}
+			l.mu.Unlock()
+			for _, c := range peers {
+				c.closeWith(err)
+			}
+			close(l.accept)
+			return
+		}
+		if n < udpHeader {
+			continue
+		}
+
+		key := from.String()
+		l.mu.Lock()
+		c, ok := l.peers[key]
+		if !ok {
+			// only first message of client opens connection, late packets of
+			// closed one are ignored
+			if !firstPacket(data[:n]) {
+				l.mu.Unlock()
+				continue
+			}
+			c = nUDPConn(l.sock, from, func() {
+				l.mu.Lock()
+				delete(l.peers, key)
+				l.mu.Unlock()
+			})
+			select {
+			case l.accept <- c:
+				l.peers[key] = c
+			default:
+				// server is not accepting fast enough, client will retry
+				close(c.stop)
+				l.mu.Unlock()
+				continue
+			}
+		}
+		l.mu.Unlock()
+
+		c.receive(data[:n])
+	}
+}
+
+func (l *udpListener) Accept() (Conn, error) {
+	c, ok := <-l.accept
+	if !ok {
+		return nil, l.err
+	}
+	return c, nil
+}
+
+func (l *udpListener) Port() int {
+	return l.sock.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (l *udpListener) Close() {
+	l.sock.Close()
+}
+
+func firstPacket(data []byte) bool {
+	return (data[0] == packetData || data[0] == packetFragment) &&
+		data[9] == 1 && binary.LittleEndian.Uint32(data[10:]) == 0
+}
+
+type unacked struct {
+	id   uint32
+	kind byte
+	data []byte
+	sent time.Time
+}
+
+// udpConn is one side of udp connection, dialed connection owns its socket,
+// accepted one shares socket of listener
+type udpConn struct {
+	sock    *net.UDPConn
+	addr    *net.UDPAddr
+	dialed  bool
+	onClose func()
+
+	mu     sync.Mutex
+	inbox  chan netw.Buffer
+	err    error
+	closed bool
+	stop   chan struct{}
+	packet []byte
+
+	seq, delivered uint32
+	// next is id of next sent reliable message, expected of next received one
+	next, expected uint32
+	unacked        []unacked
+	ahead          map[uint32]unacked
+	// partial is received beginning of fragmented message
+	partial []byte
+
+	lastSend, lastRecv time.Time
+}
+
+func nUDPConn(sock *net.UDPConn, addr *net.UDPAddr, onClose func()) *udpConn {
+	now := time.Now()
+	c := &udpConn{
+		sock:     sock,
+		addr:     addr,
+		dialed:   onClose == nil,
+		onClose:  onClose,
+		inbox:    make(chan netw.Buffer, 256),
+		stop:     make(chan struct{}),
+		ahead:    map[uint32]unacked{},
+		lastSend: now,
+		lastRecv: now,
+	}
+	go c.tick()
+	return c
+}
+
+// read reads packets of dialed connection
+func (c *udpConn) read() {
+	data := make([]byte, udpHeader+MaxPacket)
+	for {
+		n, err := c.sock.Read(data)
+		if err != nil {
+			c.closeWith(err)
+			return
+		}
+		if n >= udpHeader {
+			c.receive(data[:n])
+		}
+	}
+}
+
+// tick resends reliable messages, keeps connection alive and times it out
+func (c *udpConn) tick() {
+	t := time.NewTicker(ResendPeriod / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-t.C:
+			c.mu.Lock()
+			if now.Sub(c.lastRecv) > ConnTimeout {
+				c.mu.Unlock()
+				c.closeWith(ErrUDPTimeout)
+				return
+			}
+			for i := range c.unacked {
+				u := &c.unacked[i]
+				if now.Sub(u.sent) > ResendPeriod {
+					c.write(u.kind, true, u.id, u.data)
+					u.sent = now
+				}
+			}
+			if now.Sub(c.lastSend) > KeepAlivePeriod {
+				c.write(packetPing, false, 0, nil)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// receive processes one packet
+func (c *udpConn) receive(data []byte) {
+	kind := data[0]
+	seq := binary.LittleEndian.Uint32(data[1:])
+	ack := binary.LittleEndian.Uint32(data[5:])
+	reliable := data[9] == 1
+	id := binary.LittleEndian.Uint32(data[10:])
+	payload := data[udpHeader:]
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.lastRecv = time.Now()
+
+	i := 0
+	for i < len(c.unacked) && c.unacked[i].id < ack {
+		i++
+	}
+	c.unacked = c.unacked[i:]
+
+	switch kind {
+	case packetClose:
+		c.mu.Unlock()
+		c.closeWith(ErrUDPClosed)
+		return
+	case packetData, packetFragment:
+		if !reliable {
+			if kind == packetData && seq > c.delivered && c.deliver(payload) {
+				c.delivered = seq
+			}
+			break
+		}
+
+		if id >= c.expected && id-c.expected < MaxUnacked {
+			if _, ok := c.ahead[id]; !ok {
+				c.ahead[id] = unacked{id: id, kind: kind, data: append([]byte(nil), payload...)}
+			}
+		}
+		for {
+			p, ok := c.ahead[c.expected]
+			if !ok {
+				break
+			}
+			if p.kind == packetFragment {
+				if len(c.partial)+len(p.data) > MaxFrame {
+					c.mu.Unlock()
+					c.closeWith(ErrUDPTooLarge.Args(len(c.partial)+len(p.data), MaxFrame))
+					return
+				}
+				c.partial = append(c.partial, p.data...)
+			} else if c.partial != nil {
+				if !c.deliver(append(c.partial, p.data...)) {
+					break
+				}
+				c.partial = nil
+			} else if !c.deliver(p.data) {
+				break
+			}
+			delete(c.ahead, c.expected)
+			c.expected++
+		}
+		// ack right away so peer does not resend needlessly
+		c.write(packetPing, false, 0, nil)
+	}
+	c.mu.Unlock()
+}
+
+// deliver passes message to inbox unless it is full
+func (c *udpConn) deliver(payload []byte) bool {
+	select {
+	case c.inbox <- netw.Buffer{Data: append([]byte(nil), payload...)}:
+		return true
+	default:
+		return false
+	}
+}
+
+// write sends packet, caller holds the lock
+func (c *udpConn) write(kind byte, reliable bool, id uint32, payload []byte) {
+	c.seq++
+	p := c.packet[:0]
+	p = append(p, kind)
+	p = appendUint32(p, c.seq)
+	p = appendUint32(p, c.expected)
+	if reliable {
+		p = append(p, 1)
+	} else {
+		p = append(p, 0)
+	}
+	p = appendUint32(p, id)
+	p = append(p, payload...)
+	c.packet = p
+
+	// lost packets are handled by resending, errors do not matter
+	if c.dialed {
+		c.sock.Write(p)
+	} else {
+		c.sock.WriteToUDP(p, c.addr)
+	}
+	c.lastSend = time.Now()
+}
+
+func appendUint32(p []byte, v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return append(p, b[:]...)
+}
+
+func (c *udpConn) Inbox() <-chan netw.Buffer {
+	return c.inbox
+}
+
+// Send sends message, messages that do not fit into one packet are
+// fragmented and sent reliably even if they are not reliable
+func (c *udpConn) Send(data []byte, reliable bool) {
+	if len(data) > MaxFrame {
+		c.closeWith(ErrUDPTooLarge.Args(len(data), MaxFrame))
+		return
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	if !reliable && len(data) <= MaxPacket {
+		c.write(packetData, false, 0, data)
+		c.mu.Unlock()
+		return
+	}
+	if fragments := 1 + (len(data)-1)/MaxPacket; len(c.unacked)+fragments > MaxUnacked {
+		c.mu.Unlock()
+		c.closeWith(ErrUDPBacklog)
+		return
+	}
+	now := time.Now()
+	for kind := packetFragment; kind == packetFragment; {
+		part := data
+		if len(data) > MaxPacket {
+			part = data[:MaxPacket]
+		} else {
+			kind = packetData
+		}
+		data = data[len(part):]
+
+		u := unacked{c.next, kind, append([]byte(nil), part...), now}
+		c.next++
+		c.unacked = append(c.unacked, u)
+		c.write(u.kind, true, u.id, u.data)
+	}
+	c.mu.Unlock()
+}
+
+func (c *udpConn) Err() error {
+	return c.err
+}
+
+func (c *udpConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// Close tells peer connection ended, the notice is not resent so peer may
+// also end by timeout
+func (c *udpConn) Close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.write(packetClose, false, 0, nil)
+	}
+	c.mu.Unlock()
+	c.closeWith(ErrUDPClosed)
+}
+
+// closeWith ends connection with err, only first call has effect
+func (c *udpConn) closeWith(err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.err = err
+	close(c.inbox)
+	c.mu.Unlock()
+
+	close(c.stop)
+	if c.dialed {
+		c.sock.Close()
+	} else if c.onClose != nil {
+		c.onClose()
+	}
+}
@@ -0,0 +1,90 @@
+package game
+
+import (
+	"math"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/mlok/mat/angle"
+)
+
+// DefaultViolations is amount of invalid inputs after which server kicks
+// the client
+const DefaultViolations = 30
+
+// MaxClicks is how many times per second player can start shooting, it is
+// also how many clicks can come at once
+const MaxClicks = 20
+
+// Validate fixes invalid parts of input and returns name of violation or
+// empty string, t is tank of session or nil
+func (w *World) Validate(ss *Session, in *InputMessage, t *Tank) string {
+	violation := ""
+
+	for i := range in.Input {
+		if in.Input[i].State > binding.JustPressed {
+			in.Input[i].State = binding.Released
+			violation = "control_state"
+		}
+	}
+
+	if !finite(in.Aim) {
+		in.Aim = mat.ZV
+		if t != nil {
+			in.Aim = t.Aim
+		}
+		violation = "aim"
+	}
+	if t != nil {
+		in.Aim = w.ClampAim(t, in.Aim)
+	}
+
+	shooting := in.Input.State(Shoot) >= binding.Pressed
+	ss.Clicks = math.Max(ss.Clicks-w.Step*MaxClicks, 0)
+	if shooting && !ss.Shooting {
+		ss.Clicks++
+		if ss.Clicks > MaxClicks {
+			violation = "fire_rate"
+		}
+	}
+	ss.Shooting = shooting
+
+	if !finite(in.Eye) || !finite(in.Sight) || in.Sight.X < 0 || in.Sight.Y < 0 {
+		in.Eye, in.Sight = ss.Eye, ss.Sight
+		violation = "camera"
+	}
+
+	return violation
+}
+
+// ClampAim returns aim turned from current aim of tank towards the new one at
+// most by how much its fastest turret turns in one tick
+func (w *World) ClampAim(t *Tank, aim mat.Vec) mat.Vec {
+	speed := 0.
+	for i := range t.Guns {
+		speed = math.Max(speed, t.Guns[i].TurnSpeed)
+	}
+
+	from, to := t.Pos.To(t.Aim), t.Pos.To(aim)
+	if len(t.Guns) == 0 || from.Len() == 0 || to.Len() == 0 {
+		return aim
+	}
+
+	return t.Pos.Add(mat.Rad(angle.Turn(from.Angle(), to.Angle(), speed*w.Step), to.Len()))
+}
+
+// Violation records invalid input of client and kicks it once it reaches
+// MaxViolations of server
+func (w *World) Violation(ss *Session, violation string) {
+	ss.Violations++
+	w.Event("violation", "client", ss.ID, "name", ss.Name, "violation", violation, "count", ss.Violations)
+
+	if max := w.Server.MaxViolations; max != 0 && ss.Violations >= max && ss.Kicked == nil {
+		w.Event("kick", "client", ss.ID, "name", ss.Name, "reason", "violations")
+		w.Kick(ss, "too many invalid inputs")
+	}
+}
+
+func finite(v mat.Vec) bool {
+	return !math.IsNaN(v.X) && !math.IsNaN(v.Y) && !math.IsInf(v.X, 0) && !math.IsInf(v.Y, 0)
+}
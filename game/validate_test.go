@@ -0,0 +1,100 @@
+package game
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jakubDoka/mlok/ggl/key/binding"
+	"github.com/jakubDoka/mlok/logic/netw"
+	"github.com/jakubDoka/mlok/mat"
+)
+
+// session returns client session that said hello to server in running match
+func session(t *testing.T, s *World) *Session {
+	t.Helper()
+	ss := &Session{Net: NNet(&fakeConn{inbox: make(chan netw.Buffer)}), ID: 1, Tank: -1, Acked: -1}
+	if err := s.Handle(ss, hello(NetVersion, "tester", s.Stats.Hash())); err != nil {
+		t.Fatal(err)
+	}
+	s.GameState = MultiplayerServer
+	return ss
+}
+
+func TestInputRateViolations(t *testing.T) {
+	s := host(t, TCP{}, "hard")
+	ss := session(t, s)
+
+	for i := 1; i <= InputBuffer+3; i++ {
+		in := InputMessage{Seq: i, Input: Bindings.Clone()}
+		b := encode(func(b *netw.Buffer) {
+			b.PutUint16(uint16(InputFrame))
+			in.Write(b)
+		})
+		if err := s.Handle(ss, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ss.Inputs) != InputBuffer {
+		t.Fatalf("server keeps %d inputs", len(ss.Inputs))
+	}
+	if ss.Violations != 3 {
+		t.Fatalf("dropped inputs counted as %d violations", ss.Violations)
+	}
+}
+
+func TestFireRateViolations(t *testing.T) {
+	s := host(t, TCP{}, "hard")
+	ss := session(t, s)
+
+	// clicking every period ticks for ten seconds
+	click := func(period int) string {
+		violation := ""
+		for i := 0; i < int(10/s.Step); i++ {
+			in := InputMessage{Input: Bindings.Clone()}
+			if i%period == 0 {
+				in.Input[Shoot].State = binding.JustPressed
+			}
+			if v := s.Validate(ss, &in, nil); v != "" {
+				violation = v
+			}
+		}
+		return violation
+	}
+
+	if v := click(int(1 / s.Step / (MaxClicks / 2))); v != "" {
+		t.Fatalf("human clicking is %s violation", v)
+	}
+	if v := click(2); v != "fire_rate" {
+		t.Fatalf("expected fire_rate violation, got %q", v)
+	}
+}
+
+func TestClampAim(t *testing.T) {
+	w := testWorld(t, "hard", 1)
+	for w.Tanks.Count() == 0 {
+		simulate(w, 10)
+	}
+	tank := w.Tanks.Item(w.Tanks.Occupied()[0])
+
+	speed := 0.
+	for i := range tank.Guns {
+		speed = math.Max(speed, tank.Guns[i].TurnSpeed)
+	}
+	step := speed * w.Step
+	if step == 0 || step > math.Pi/2 {
+		t.Fatalf("turret speed %g does not allow the test", speed)
+	}
+
+	tank.Aim = tank.Pos.Add(mat.V(100, 0))
+	aim := w.ClampAim(tank, tank.Pos.Add(mat.V(0, 200)))
+	to := tank.Pos.To(aim)
+	if math.Abs(to.Angle()-step) > 1e-9 || math.Abs(to.Len()-200) > 1e-9 {
+		t.Fatalf("aim turned by %g to distance %g, expected %g and 200", to.Angle(), to.Len(), step)
+	}
+
+	near := tank.Pos.Add(mat.Rad(step/2, 50))
+	if aim := w.ClampAim(tank, near); aim.To(near).Len() > 1e-9 {
+		t.Fatalf("small turn was clamped to %v", aim)
+	}
+}
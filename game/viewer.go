@@ -0,0 +1,209 @@
+package game
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jakubDoka/mlok/ggl"
+	"github.com/jakubDoka/mlok/ggl/key"
+	"github.com/jakubDoka/mlok/ggl/ui"
+	"github.com/jakubDoka/mlok/mat"
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+// CheckpointPeriod is amount of ticks between viewer checkpoints
+const CheckpointPeriod = TickRate * 5
+
+// Speeds are playback speeds viewer can switch between
+var Speeds = []float64{.25, .5, 1, 2, 4, 8}
+
+// Kill is death event recorded in replay
+type Kill struct {
+	Tick           int
+	Killer, Victim string
+}
+
+func (k Kill) String() string {
+	return fmt.Sprintf("%s %s killed %s", TickTime(k.Tick), k.Killer, k.Victim)
+}
+
+// TickTime formats tick as minutes and seconds of match
+func TickTime(tick int) string {
+	s := tick / TickRate
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// Viewer controls replay playback, it can pause, change speed and seek, seeking
+// backwards restores closest checkpoint instead of simulating from tick zero
+type Viewer struct {
+	*Replay
+	Checkpoints []*Checkpoint
+
+	Speed          int
+	Paused, Follow bool
+}
+
+// WatchReplay starts replay playback in viewer scene
+func (w *World) WatchReplay(r *Replay) error {
+	err := w.PlayReplay(r)
+	if err != nil {
+		return err
+	}
+
+	w.GameState = Replaying
+	w.Viewer = &Viewer{
+		Replay:      r,
+		Checkpoints: []*Checkpoint{w.Capture()},
+		Speed:       2,
+		Follow:      true,
+	}
+
+	if !w.Headless {
+		w.SetScene("replay")
+		w.UpdateViewerUI()
+	}
+
+	return nil
+}
+
+// UpdateViewer advances replay by delta scaled with playback speed and handles
+// free camera
+func (w *World) UpdateViewer(win *ggl.Window, delta float64) {
+	v := w.Viewer
+
+	if win.MouseScroll().Y != 0 {
+		w.Zoom *= 1 + win.MouseScroll().Y*(w.Assets.ScrollSensitivity+.2)
+		w.Zoom = mat.Clamp(w.Zoom, .1, 3)
+	}
+
+	if win.JustPressed(key.Space) {
+		w.TogglePause()
+	}
+
+	var move mat.Vec
+	if win.Pressed(key.W) || win.Pressed(key.Up) {
+		move.Y--
+	}
+	if win.Pressed(key.S) || win.Pressed(key.Down) {
+		move.Y++
+	}
+	if win.Pressed(key.A) || win.Pressed(key.Left) {
+		move.X++
+	}
+	if win.Pressed(key.D) || win.Pressed(key.Right) {
+		move.X--
+	}
+	if move != mat.ZV {
+		v.Follow = false
+		w.CamPos.AddE(move.Scaled(1000 * delta / w.Zoom))
+	}
+
+	if v.Follow && w.Player != -1 {
+		w.CamPos = w.Tanks.Item(w.Player).Pos.Inv()
+	}
+
+	if !w.Headless {
+		scene := w.UIScenes["replay"]
+		bar := scene.ID("timeline").Module.(*assets.Bar)
+		if win.Pressed(key.MouseLeft) && bar.Frame.Contains(win.MousePos()) {
+			w.Seek(int((win.MousePos().X - bar.Frame.Min.X) / bar.Frame.W() * float64(len(v.Frames))))
+		}
+	}
+
+	if v.Paused {
+		return
+	}
+
+	w.Accumulated += math.Min(delta, .1) * Speeds[v.Speed]
+	for w.Accumulated >= w.Step && !v.Paused {
+		w.Accumulated -= w.Step
+		w.ViewerTick()
+	}
+
+	w.UpdateViewerUI()
+}
+
+// ViewerTick simulates one tick of replay and captures checkpoint if its time
+func (w *World) ViewerTick() {
+	v := w.Viewer
+	if w.Ticks >= len(v.Frames) {
+		v.Paused = true
+		return
+	}
+
+	w.Simulate(w.Step)
+
+	if w.Ticks%CheckpointPeriod == 0 && len(v.Checkpoints) == w.Ticks/CheckpointPeriod {
+		v.Checkpoints = append(v.Checkpoints, w.Capture())
+	}
+}
+
+// Seek moves replay to given tick, it restores closest preceding checkpoint if
+// tick is behind or the checkpoint is ahead of current tick
+func (w *World) Seek(tick int) {
+	v := w.Viewer
+	tick = mat.Maxi(0, mat.Mini(tick, len(v.Frames)))
+
+	idx := mat.Mini(tick/CheckpointPeriod, len(v.Checkpoints)-1)
+	if c := v.Checkpoints[idx]; tick < w.Ticks || c.Ticks > w.Ticks {
+		w.Restore(c)
+	}
+
+	for w.Ticks < tick {
+		w.ViewerTick()
+	}
+
+	w.UpdateViewerUI()
+}
+
+// SetSpeed changes playback speed by offset, speed is clamped to Speeds
+func (w *World) SetSpeed(offset int) {
+	v := w.Viewer
+	v.Speed = mat.Maxi(0, mat.Mini(v.Speed+offset, len(Speeds)-1))
+	w.UpdateViewerUI()
+}
+
+// TogglePause pauses or resumes the replay
+func (w *World) TogglePause() {
+	v := w.Viewer
+	v.Paused = !v.Paused
+	if !v.Paused && w.Ticks >= len(v.Frames) {
+		w.Seek(0)
+	}
+	w.UpdateViewerUI()
+}
+
+// UpdateViewerUI displays viewer state
+func (w *World) UpdateViewerUI() {
+	if w.Headless {
+		return
+	}
+
+	v := w.Viewer
+	scene := w.UIScenes["replay"]
+
+	bar := scene.ID("timeline").Module.(*assets.Bar)
+	bar.Progress = float64(w.Ticks)
+	bar.Max = math.Max(float64(len(v.Frames)), 1)
+
+	scene.ID("time").Module.(*ui.Text).SetText(TickTime(w.Ticks) + "/" + TickTime(len(v.Frames)))
+	scene.ID("speed").Module.(*ui.Text).SetText(fmt.Sprintf("%gx", Speeds[v.Speed]))
+
+	pause := scene.ID("Pause").Module.(*ui.Button)
+	if v.Paused {
+		pause.SetText("Play")
+	} else {
+		pause.SetText("Pause")
+	}
+
+	scene.Redraw.Notify()
+}
+
+// StopViewer leaves the replay
+func (w *World) StopViewer() {
+	w.Viewer = nil
+	w.Playback = nil
+	w.Player = -1
+	w.GameState = Menu
+	w.SetScene("main_menu")
+}
@@ -2,15 +2,18 @@ package game
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/jakubDoka/mlok/ggl"
 	"github.com/jakubDoka/mlok/ggl/drw"
 	"github.com/jakubDoka/mlok/ggl/key"
 	"github.com/jakubDoka/mlok/ggl/key/binding"
 	"github.com/jakubDoka/mlok/ggl/ui"
-	"github.com/jakubDoka/mlok/logic/ai"
 	"github.com/jakubDoka/mlok/logic/frame"
 	"github.com/jakubDoka/mlok/logic/spatial"
 	"github.com/jakubDoka/mlok/logic/timer"
@@ -24,12 +27,39 @@ import (
 
 //go:generate genny -pkg=game -in=$GOPATH\pkg\mod\github.com\jakub!doka\mlok@v0.3.7\logic\memory\storage.go -out=gen-storage.go gen "Element=Tank,Bullet"
 
+// TickRate is default amount of fixed simulation ticks per second
+const TickRate = 60
+
 type World struct {
 	assets.World
 	Original  *assets.World
 	Spawning  timer.Timer
 	GameState State
 
+	// Step is fixed simulation delta, if zero, world is simulated with
+	// frame delta instead and results are not reproducible
+	Step, Accumulated float64
+	Ticks             int
+
+	// Recorder records player inputs, Playback feeds them back instead of window
+	Recorder, Playback *Replay
+	Viewer             *Viewer
+	// Predicting is true while client replays its inputs, it makes tanks
+	// skip firing and ram damage
+	Predicting bool
+
+	// Server is not nil when world hosts multiplayer match, Client when it
+	// plays on someone else's
+	Server *Server
+	Client *Client
+	// Discovery lists games on local network while multiplayer screen is open
+	Discovery *Discovery
+	// LocalStats are own stats while client plays with stats of server
+	LocalStats *assets.Stats
+	// EventLog receives server events, nil disables logging
+	EventLog io.Writer
+	Chat     ChatBox
+
 	Delta float64
 	Frame mat.AABB
 
@@ -38,9 +68,16 @@ type World struct {
 
 	Tanks   TankStorage
 	Bullets BulletStorage
+	// Rammed are killer and victim of ram kills, they are resolved after
+	// tank is stepped as leveling up can move tanks in storage
+	Rammed [][2]int
 
 	Hasher spatial.MinHash
-	Drawer drw.Geom
+	// Static holds obstacles of the world, ids are indexes to Obstacles
+	Static     spatial.QuadTree
+	StaticBuff [3][]int
+	Nav        NavGrid
+	Drawer     drw.Geom
 
 	CamPos mat.Vec
 	Zoom   float64
@@ -50,12 +87,15 @@ type World struct {
 	Player, TotalScore int
 
 	rnd.Rnd
+	Source Source
 
 	Buff []int
 
 	FpsTimer timer.Timer
 	Limmiter frame.Limitter
 	Fps      int
+
+	Headless bool
 }
 
 func NWorld(a *assets.Assets) *World {
@@ -64,6 +104,8 @@ func NWorld(a *assets.Assets) *World {
 		Zoom:     1,
 		Player:   -1,
 		FpsTimer: timer.Period(1),
+		Step:     1. / TickRate,
+		EventLog: os.Stdout,
 	}
 
 	w.Limmiter.SetFPS(60)
@@ -75,35 +117,95 @@ func NWorld(a *assets.Assets) *World {
 	return w
 }
 
-func (w *World) LoadMap(singleplayer bool, world *assets.World) {
+// NHeadlessWorld creates world that does not need a window, it can only be
+// driven by Simulate
+func NHeadlessWorld(a *assets.Assets) *World {
+	return &World{
+		Assets:   a,
+		Zoom:     1,
+		Player:   -1,
+		Headless: true,
+		Step:     1. / TickRate,
+	}
+}
+
+// LoadMap loads the world seeded by its seed property, if world has no seed
+// the current time is used
+func (w *World) LoadMap(state State, world *assets.World) {
+	seed := world.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	w.LoadMapSeed(state, world, seed)
+}
+
+// LoadMapSeed loads the world with given seed, same seed and same inputs
+// always produce the same match, state is the mode match will be played in
+func (w *World) LoadMapSeed(state State, world *assets.World, seed int64) {
 	w.Original = world
 	w.World = *world
+	w.World.Seed = seed
 	w.TotalScore = 0
+	w.Player = -1
+	w.Ticks = 0
+	w.Accumulated = 0
+	w.Recorder = nil
+	w.Playback = nil
+	w.Viewer = nil
 
 	size := w.Size.Div(w.Tile).Point()
 	w.Hasher = spatial.NMinHash(size.X, size.Y, w.Tile)
+	w.BuildStatic()
+	w.BuildNav()
 	w.Spawning = timer.Period(w.SpawnRate)
-	w.Rnd = rnd.Time()
+	w.Source.Seed(seed)
+	w.Rnd = rnd.Rnd{Rand: rand.New(&w.Source)}
 
 	w.Drawer.Restart()
 	w.Tanks.Clear()
 	w.Bullets.Clear()
 
-	if singleplayer {
-		w.UIScenes["singleplayer"].ID("poppup").SetHidden(true)
-
+	if !w.Headless {
+		scene := w.UIScenes["singleplayer"]
+		scene.ID("poppup").SetHidden(true)
+		scene.ID("Save & Quit").SetHidden(state != Singleplayer)
 		w.SetScene("singleplayer")
-		t, _, ok := w.Assets.Tanks.Tank(w.World.Player)
-		if ok {
-			w.CreateTank(true, 0, mat.ZV, 0, 0, t)
-		} else {
-			w.RandomSpawn(true, 0)
+	}
+
+	switch state {
+	case Singleplayer:
+		if !w.Headless {
+			w.Recorder = w.NReplay()
 		}
 
+		w.SpawnPlayer()
 		w.UpdateScore()
-		w.GameState = Singleplayer
-	} else {
+	case MultiplayerServer:
+		// dedicated server has no local player
+		if !w.Headless {
+			w.SpawnPlayer()
+			w.UpdateScore()
+		}
+	case MultiplayerClient:
+		// tanks come with snapshots
+	}
 
+	w.GameState = state
+}
+
+// SpawnPlayer creates local player tank, world can specify the tank, host
+// gets the tank chosen in lobby
+func (w *World) SpawnPlayer() {
+	if w.Server != nil {
+		w.SpawnChoice(0)
+		return
+	}
+
+	t, _, ok := w.Assets.Tanks.Tank(w.World.Player)
+	if ok {
+		w.CreateTank(true, 0, 0, mat.ZV, 0, 0, t)
+	} else {
+		w.RandomSpawn(true, 0, 0)
 	}
 }
 
@@ -111,6 +213,8 @@ func (w *World) SetScene(name string) {
 	w.UI.SetScene(w.Assets.UIScenes[name])
 }
 
+// Update is the window loop step, it reads input, simulates, renders the world and
+// processes the ui
 func (w *World) Update(win *ggl.Window, delta float64) {
 	if w.FpsTimer.TickDoneReset(delta) {
 		w.UpdateFps()
@@ -119,51 +223,128 @@ func (w *World) Update(win *ggl.Window, delta float64) {
 	w.Fps++
 	//w.Limmiter.Regulate()
 
-	w.Delta = math.Min(delta, .1)
-	win.SetCamera(w.View())
-	w.Frame = win.Rect()
-	spc := mat.V(100, 100)
-	w.Frame.Min.SubE(spc)
-	w.Frame.Max.AddE(spc)
+	if w.Discovery != nil {
+		w.Discover()
+	}
+	w.UpdateChat(win)
 
-	if w.GameState != Menu {
-		w.Batch.Clear()
-		w.Drawer.Fetch(&w.Batch)
-		w.Drawer.Clear()
-		w.Drawer.Color(w.Background).AABB(w.Size.ToAABB())
-		col := w.Background.Inverted()
-		col.A = .1
+	if w.GameState == Replaying {
+		w.UpdateViewer(win, delta)
+	} else if w.GameState == MultiplayerClient {
+		w.UpdateClient(win, delta)
+	} else if w.GameState == InLobby {
+		w.UpdateLobby(delta)
+	} else if w.GameState != Menu {
 		w.UpdatePlayer(win)
+		w.Advance(delta)
+	}
 
-		for _, id := range w.Tanks.Occupied() {
-			t := w.Tanks.Item(id)
-			w.Drawer.Color(col)
-			w.DrawTank(t)
-			w.UpdateTank(t)
-			w.ControlTank(t)
+	// simulation can end the game
+	if w.GameState != Menu && w.GameState != InLobby {
+		w.Render(win)
+	}
 
-			if t.Dead() {
-				w.Tanks.Remove(id)
-				w.Hasher.Remove(t.Address, t.ID, t.Group)
-			}
+	w.UpdateUI(win, delta)
+}
+
+// Advance simulates as many fixed ticks as fit into accumulated delta, if Step
+// is zero it simulates just once with delta
+func (w *World) Advance(delta float64) {
+	delta = math.Min(delta, .1)
+	if w.Step == 0 {
+		w.Simulate(delta)
+		return
+	}
+
+	w.Accumulated += delta
+	for w.Accumulated >= w.Step && w.GameState != Menu {
+		w.Accumulated -= w.Step
+		w.Simulate(w.Step)
+	}
+}
+
+// Simulate advances the match by delta, it does not touch window, rendering or ui
+// so it can run headless
+func (w *World) Simulate(delta float64) {
+	w.Delta = delta
+
+	if w.Playback != nil {
+		if !w.Playback.Apply(w, w.Ticks) {
+			w.Playback = nil
 		}
+	} else if w.Recorder != nil {
+		w.Recorder.Record(w)
+	}
+	w.Ticks++
+	w.Nav.Budget = PathBudget
 
-		for _, id := range w.Bullets.Occupied() {
-			b := w.Bullets.Item(id)
+	if w.Server != nil {
+		w.Receive()
+	}
 
-			w.DrawBullet(b)
-			w.UpdateBullet(b)
+	for _, id := range w.Tanks.Occupied() {
+		t := w.Tanks.Item(id)
+		t.Animate(w.Delta)
+		w.StepTank(t)
+		w.ResolveRams()
 
-			if b.Live.Done() {
-				w.Bullets.Remove(id)
-			}
+		t = w.Tanks.Item(id)
+		if t.Dead() {
+			w.Tanks.Remove(id)
+			w.Hasher.Remove(t.Address, t.ID, t.Group)
+		}
+	}
+
+	for _, id := range w.Bullets.Occupied() {
+		b := w.Bullets.Item(id)
+
+		w.UpdateBullet(b)
+
+		if b.Live.Done() {
+			w.Bullets.Remove(id)
+		}
+	}
+
+	w.Spawn()
+
+	if w.Server != nil {
+		w.Broadcast()
+		if w.Server.Restart {
+			w.StartMatch()
 		}
+	}
+}
+
+// Render draws the world to window
+func (w *World) Render(win *ggl.Window) {
+	win.SetCamera(w.View())
+	w.Frame = win.Rect()
+	spc := mat.V(100, 100)
+	w.Frame.Min.SubE(spc)
+	w.Frame.Max.AddE(spc)
 
-		w.Spawn()
+	w.Batch.Clear()
+	w.Drawer.Fetch(&w.Batch)
+	w.Drawer.Clear()
+	w.Drawer.Color(w.Background).AABB(w.Size.ToAABB())
+	w.DrawObstacles()
+	col := w.Background.Inverted()
+	col.A = .1
 
-		w.Batch.Draw(win)
+	for _, id := range w.Tanks.Occupied() {
+		w.Drawer.Color(col)
+		w.DrawTank(w.Tanks.Item(id))
 	}
 
+	for _, id := range w.Bullets.Occupied() {
+		w.DrawBullet(w.Bullets.Item(id))
+	}
+
+	w.Batch.Draw(win)
+}
+
+// UpdateUI updates and draws the ui on top of the world, then swaps the window buffers
+func (w *World) UpdateUI(win *ggl.Window, delta float64) {
 	w.Batch.Clear()
 	w.UI.SetFrame(win.Frame())
 	w.UI.Update(win, delta)
@@ -171,14 +352,12 @@ func (w *World) Update(win *ggl.Window, delta float64) {
 	win.SetCamera(mat.IM)
 	w.Batch.Draw(win)
 
-	if w.GameState == Menu {
-		win.Update()
+	win.Update()
+	if w.GameState == Menu || w.GameState == InLobby {
 		win.Clear(rgba.Black)
-		return
+	} else {
+		win.Clear(w.Background.Inverted())
 	}
-
-	win.Update()
-	win.Clear(w.Background.Inverted())
 }
 
 func (w *World) UpdateFps() {
@@ -192,21 +371,27 @@ func (w *World) Spawn() {
 		return
 	}
 
-	w.RandomSpawn(false, 1+w.Intn(w.TeamCount))
+	w.RandomSpawn(false, 0, 1+w.Intn(w.TeamCount))
 }
 
-func (w *World) RandomSpawn(player bool, group int) {
+func (w *World) RandomSpawn(player bool, client, group int) {
 	choice, _, ok := w.Assets.Tanks.Tank(w.Spawns[w.Intn(len(w.Spawns))])
 	if !ok {
 		return
 	}
+	w.SpawnTank(player, client, group, choice)
+}
+
+// SpawnTank creates tank on random position
+func (w *World) SpawnTank(player bool, client, group int, tank *assets.Tank) {
 	w.CreateTank(
 		player,
+		client,
 		group,
 		mat.V(w.Float64()*w.Size.X, w.Float64()*w.Size.Y),
 		w.Float64()*angle.Pi2,
 		w.Float64()*angle.Pi2,
-		choice,
+		tank,
 	)
 }
 
@@ -223,8 +408,20 @@ func (w *World) UpdatePlayer(win *ggl.Window) {
 		w.Zoom = mat.Clamp(w.Zoom, .5, 3)
 	}
 
-	p.Input.Update(win)
 	w.CamPos = p.Pos.Inv()
+	if w.Playback != nil {
+		return
+	}
+
+	// typing into chat does not drive the tank
+	if w.Chat.Open {
+		for i := range p.Input {
+			p.Input[i].State = binding.Released
+		}
+		return
+	}
+
+	p.Input.Update(win)
 	prj := w.View().Unproject(win.MousePos())
 	p.Aim = prj
 }
@@ -233,23 +430,26 @@ func (w *World) View() mat.Mat {
 	return mat.IM.Move(w.CamPos).Scaled(mat.ZV, w.Zoom)
 }
 
-func (w *World) UpdateTank(t *Tank) {
-	t.Reloader.Tick(w.Delta)
-	if !t.HealInter.Done() {
-		col := t.HealInter.Update(w.Delta)
-		t.Mask.R = col
-		t.Mask.B = col
-	}
-	if !t.HitInter.Done() {
-		col := t.HitInter.Update(w.Delta)
-		t.Mask.G = col
-		t.Mask.B = col
+// StepTank advances tank by one tick, server and client prediction share it
+// so predicted tank moves the same way as the authoritative one
+func (w *World) StepTank(t *Tank) {
+	for i := range t.Guns {
+		t.Guns[i].Reloader.Tick(w.Delta)
+		t.Guns[i].Burst.Tick(w.Delta)
 	}
-	t.Pos.AddE(t.Vel.Scaled(w.Delta))
-	t.Vel.SubE(t.Vel.Scaled(mat.Clamp(w.Friction*w.Delta, 0, 1)))
+	w.MoveTank(t)
+	w.CollideTanks(t)
+	w.CollideTank(t)
 	t.Heal(w.Delta)
 
 	w.Hasher.Update(&t.Address, t.Pos, t.ID, t.Group)
+	w.ControlTank(t)
+}
+
+// MoveTank applies velocity and friction
+func (w *World) MoveTank(t *Tank) {
+	t.Pos.AddE(t.Vel.Scaled(w.Delta))
+	t.Vel.SubE(t.Vel.Scaled(mat.Clamp(w.Friction*w.Delta, 0, 1)))
 }
 
 func (w *World) DrawTank(t *Tank) {
@@ -257,24 +457,23 @@ func (w *World) DrawTank(t *Tank) {
 		return
 	}
 
-	p := w.Tanks.Item(w.Player)
-
-	if mat.Square(t.Pos, t.Size).Contains(p.Aim) {
-		t.BarInter.Reset()
+	var group int
+	if w.Player != -1 {
+		p := w.Tanks.Item(w.Player)
+		group = p.Group
+		if mat.Square(t.Pos, t.Size).Contains(p.Aim) {
+			t.BarInter.Reset()
+		}
 	}
 
 	w.DrawTile(t.Pos, t.Size)
 
 	t.BaseSprite.Draw(&w.Batch, mat.M(t.Pos, w.Scale, t.BaseRot), t.Mask)
-	t.TurretSprite.Draw(
-		&w.Batch,
-		mat.M(t.Pos.Add(t.TurretOffset.Rotated(t.BaseRot)), w.Scale, t.BaseRot+t.TurretRot),
-		t.Mask,
-	)
+	w.DrawGuns(t)
 
 	if !t.BarInter.Done() {
 		col := mat.Alpha(t.BarInter.Update(w.Delta))
-		if t.Group != p.Group {
+		if t.Group != group {
 			col = col.Mul(rgba.Red)
 		} else {
 			col = col.Mul(rgba.Green)
@@ -300,36 +499,28 @@ func (w *World) DrawTile(pos mat.Vec, size float64) {
 
 }
 
-func (w *World) CreateTank(player bool, group int, pos mat.Vec, rot, trot float64, tank *assets.Tank) *Tank {
+// CreateTank allocates new tank, client is id of remote client controlling the
+// player tank, local player has client 0
+func (w *World) CreateTank(player bool, client, group int, pos mat.Vec, rot, trot float64, tank *assets.Tank) *Tank {
 	t, id := w.Tanks.Allocate()
 
-	t.Tank = tank
+	t.Init(tank)
 	t.Pos = pos
 	t.BaseRot = rot
-	t.TurretRot = trot
-	t.Health = tank.MaxHealth
-	t.Reloader = timer.Period(tank.ReloadSpeed)
-	t.Input = Bindings.Clone()
-	t.BaseSprite = tank.BaseSprite
-	t.TurretSprite = tank.TurretSprite
+	t.InitGuns(trot)
 	t.Group = group
 	t.ID = id
-	t.Target = -1
 	t.Player = player
-	t.Healing = timer.Period(tank.RegenerationProc)
-	t.Mask = rgba.White
-
-	t.HealInter.End = 1
-	t.HitInter.End = 1
-	t.BarInter.Start = .8
-	t.HitInter.Timer = timer.Period(.2)
-	t.HealInter.Timer = timer.Period(tank.RegenerationTick)
-	t.BarInter.Timer = timer.Period(2)
+	t.Client = client
 
-	t.TurretSprite.SetPivot(t.TurretPivot)
 	w.Hasher.Insert(&t.Address, t.Pos, t.ID, t.Group)
 
-	if player {
+	if w.Server != nil {
+		_, idx, _ := w.Assets.Tanks.Tank(tank.Name)
+		w.Server.Spawns = append(w.Server.Spawns, SpawnMessage{id, idx, client, group})
+	}
+
+	if player && client == 0 {
 		if w.Player != -1 && w.Tanks.Used(w.Player) {
 			w.Tanks.Item(w.Player).Health = 0
 		}
@@ -346,16 +537,7 @@ func (w *World) ControlTank(t *Tank) {
 		return
 	}
 
-	total := t.TurretRot + t.BaseRot
-	dir := t.Pos.To(t.Aim).Angle()
-	t.TurretRot = angle.Turn(angle.Norm(total), dir, t.TurretSpeed*w.Delta) - t.BaseRot
-
-	if t.Input.Pressed(Shoot) && t.Reloader.DoneReset() {
-		w.CreateBullet(
-			t.Pos.Add(t.TurretOffset.Rotated(t.BaseRot)).Add(mat.Rad(total, t.TurretLen)),
-			t.Vel, t.Group, t.ID, total, &t.Bullet,
-		)
-	}
+	w.ControlGuns(t)
 
 	if t.Input.Pressed(Forward) {
 		t.Vel.AddE(mat.Rad(t.BaseRot, t.Speed*w.Delta))
@@ -376,9 +558,11 @@ func (w *World) ControlTank(t *Tank) {
 }
 
 func (w *World) UpdateAI(t *Tank) {
+	w.AimGuns(t)
 
+	reach := t.Range()
 	if t.Target == -1 {
-		w.Buff = w.Hasher.Query(mat.Square(t.Pos, t.Bullet.Range()), w.Buff[:0], t.Group, false)
+		w.Buff = w.Hasher.Query(mat.Square(t.Pos, reach), w.Buff[:0], t.Group, false)
 		var (
 			final = -1
 			dest  = math.MaxFloat64
@@ -391,7 +575,7 @@ func (w *World) UpdateAI(t *Tank) {
 				dest = d
 			}
 		}
-		if final == -1 || dest > t.Bullet.Range2() {
+		if final == -1 || dest > reach*reach {
 			return
 		}
 		t.Target = final
@@ -402,46 +586,36 @@ func (w *World) UpdateAI(t *Tank) {
 
 	o := w.Tanks.Item(t.Target)
 	dif := t.Pos.To(o.Pos)
-	if dif.Len2() > t.Bullet.Range2()*(1+t.Memory) {
+	if dif.Len2() > reach*reach*(1+t.Memory) {
 		t.DeTarget()
 		return
 	}
 
-	if t.ShouldRetreat() || dif.Len() < t.Bullet.Range()*t.Distancing {
-		dif = dif.Inv()
+	var move mat.Vec
+	// spread weapons prefer close range
+	if t.ShouldRetreat() || dif.Len() < reach*t.Distancing/(1+t.Spread()) {
+		move = dif.Inv()
+	} else {
+		move = t.Pos.To(w.Route(t, o.Pos)).Normalized().Scaled(dif.Len())
 	}
 
 	w.Buff = w.Hasher.Query(mat.Square(t.Pos, 0), w.Buff[:0], t.Group, true)
 	for _, id := range w.Buff {
 		o := w.Tanks.Item(id)
 		if mat.Square(t.Pos, t.Size*2).Intersects(mat.Square(o.Pos, o.Size*2)) {
-			dif.AddE(o.Pos.To(t.Pos).Normal().Scaled(dif.Len()))
+			move.AddE(o.Pos.To(t.Pos).Normal().Scaled(move.Len()))
 			break
 		}
 	}
 
-	t.BaseRot = angle.Turn(angle.Norm(t.BaseRot), dif.Angle(), t.Steer*w.Delta)
+	t.BaseRot = angle.Turn(angle.Norm(t.BaseRot), move.Angle(), t.Steer*w.Delta)
 
 	t.Input[Forward].State = binding.Pressed
-
-	var ok bool
-	t.Aim, ok = ai.Predict(t.Pos, o.Pos, o.Vel, t.Bullet.Speed)
-	if ok && t.Pos.To(t.Aim).Len2() <= t.Bullet.Range2() && math.Abs(angle.To(t.Pos.To(t.Aim).Angle(), angle.Norm(t.TurretRot+t.BaseRot))) < math.Abs(math.Atan(o.Size/dif.Len())) {
-		t.Input[Shoot].State = binding.Pressed
-	} else {
-		t.Input[Shoot].State = binding.Released
-	}
 }
 
 func (w *World) UpdateBullet(b *Bullet) {
-	bounds := mat.Square(b.Pos, b.Size)
-	w.Buff = w.Hasher.Query(bounds, w.Buff[:0], b.Group, false)
-	for _, id := range w.Buff {
+	if id := w.BulletHit(b); id != -1 {
 		t := w.Tanks.Item(id)
-		if t.Dead() || !mat.C(t.Pos.X, t.Pos.Y, t.Size).Intersects(mat.C(b.Pos.X, b.Pos.Y, b.Size)) {
-			continue
-		}
-
 		t.Hit(b)
 		if t.Dead() {
 			w.OnDeath(b.Owner, id)
@@ -450,18 +624,59 @@ func (w *World) UpdateBullet(b *Bullet) {
 		}
 		return
 	}
+	if w.Blocked(b.Pos, b.Size) {
+		b.Live.Skip()
+		return
+	}
 
 	b.Pos.AddE(mat.Rad(b.Rot, b.Speed*w.Delta))
 	b.Live.Tick(w.Delta)
 }
 
+// BulletHit returns id of tank bullet hits or -1, bullets of lagging clients
+// are tested against positions tanks had when client saw them
+func (w *World) BulletHit(b *Bullet) int {
+	if b.Rewind != 0 && w.Server != nil {
+		if f := w.Server.Rewind.At(w.Ticks - b.Rewind); f != nil {
+			return w.RewoundHit(b, f)
+		}
+	}
+
+	bounds := mat.Square(b.Pos, b.Size)
+	w.Buff = w.Hasher.Query(bounds, w.Buff[:0], b.Group, false)
+	for _, id := range w.Buff {
+		t := w.Tanks.Item(id)
+		if !t.Dead() && mat.C(t.Pos.X, t.Pos.Y, t.Size).Intersects(mat.C(b.Pos.X, b.Pos.Y, b.Size)) {
+			return id
+		}
+	}
+
+	return -1
+}
+
 func (w *World) OnDeath(killer, victim int) {
+	v := w.Tanks.Item(victim)
+	if w.Server != nil {
+		d := DeathMessage{Victim: victim, Killer: -1, KillerTank: -1}
+		_, d.VictimTank, _ = w.Assets.Tanks.Tank(v.Tank.Name)
+		if w.Tanks.Used(killer) {
+			d.Killer = killer
+			_, d.KillerTank, _ = w.Assets.Tanks.Tank(w.Tanks.Item(killer).Tank.Name)
+		}
+		w.Server.Deaths = append(w.Server.Deaths, d)
+		if v.Player {
+			w.Event("death", "client", v.Client, "tank", v.Tank.Name, "killer", d.Killer)
+		}
+	}
+
 	if !w.Tanks.Used(killer) {
 		return
 	}
 
 	k := w.Tanks.Item(killer)
-	v := w.Tanks.Item(victim)
+	if w.Recorder != nil {
+		w.Recorder.Kills = append(w.Recorder.Kills, Kill{w.Ticks, k.Describe(), v.Describe()})
+	}
 	k.Score += v.Value
 	if killer == w.Player {
 		w.TotalScore += v.Value
@@ -472,11 +687,21 @@ func (w *World) OnDeath(killer, victim int) {
 	}
 
 	if victim == w.Player {
-		w.EndGame(false)
+		if w.GameState == MultiplayerServer {
+			// host respawns as any other client
+			w.SpawnPlayer()
+			w.UpdateScore()
+		} else {
+			w.EndGame(false)
+		}
 	}
 }
 
 func (w *World) UpdateScore() {
+	if w.Headless {
+		return
+	}
+
 	t := w.Tanks.Item(w.Player)
 	scene := w.UIScenes["singleplayer"]
 	bar := scene.ID("bar").Module.(*assets.Bar)
@@ -490,7 +715,7 @@ func (w *World) LevelUp(id int) {
 	t := w.Tanks.Item(id)
 	next, _, ok := w.Assets.Tanks.Tank(t.Next)
 	if !ok || (t.Player && w.DisabledPlayer[t.Next]) || w.DisabledEnemy[t.Next] {
-		if t.Player {
+		if t.Player && t.Client == 0 && w.GameState != MultiplayerServer {
 			w.EndGame(true)
 		}
 		t.Score = 0
@@ -499,12 +724,26 @@ func (w *World) LevelUp(id int) {
 	if t.Player {
 		w.World.SpawnRate *= w.World.SpawnScaling
 	}
-	w.CreateTank(t.Player, t.Group, t.Pos, t.BaseRot, t.TurretRot, next)
-	t.Health = 0
+	w.CreateTank(t.Player, t.Client, t.Group, t.Pos, t.BaseRot, t.TurretRot(), next)
+	// storage could grow
+	w.Tanks.Item(id).Health = 0
 }
 
 func (w *World) EndGame(win bool) {
 	w.Player = -1
+	if w.GameState == Replaying {
+		return
+	}
+
+	w.StopServer()
+	w.StopClient()
+
+	w.GameState = Menu
+	w.SaveRecording()
+
+	if w.Headless {
+		return
+	}
 
 	w.SetScene("end_screen")
 	scene := w.UIScenes["end_screen"]
@@ -515,8 +754,6 @@ func (w *World) EndGame(win bool) {
 		message.SetText(w.LoseMessage)
 	}
 	scene.ID("total").Module.(*ui.Text).SetText(strconv.Itoa(w.TotalScore))
-
-	w.GameState = Menu
 }
 
 func (w *World) DrawBullet(b *Bullet) {
@@ -529,10 +766,11 @@ func (w *World) DrawBullet(b *Bullet) {
 	b.Sprite.Draw(&w.Batch, mat.M(b.Pos, w.Scale, b.Rot), rgba.White)
 }
 
-func (w *World) CreateBullet(pos, vel mat.Vec, group, owner int, dir float64, bullet *assets.Bullet) {
+func (w *World) CreateBullet(pos, vel mat.Vec, group, owner int, dir float64, bullet *assets.Bullet) *Bullet {
 	b, id := w.Bullets.Allocate()
 
 	b.Bullet = bullet
+	b.Speed = bullet.Speed
 	b.Pos = pos
 	b.Rot = dir
 	b.Live = timer.Period(bullet.LiveTime)
@@ -540,6 +778,12 @@ func (w *World) CreateBullet(pos, vel mat.Vec, group, owner int, dir float64, bu
 	b.Group = group
 	b.ID = id
 	b.Owner = owner
+	b.Rewind = 0
+	if w.Server != nil {
+		b.Rewind = w.Server.RewindOf(w.Tanks.Item(owner).Client, w.Ticks)
+	}
+
+	return b
 }
 
 const (
@@ -563,23 +807,50 @@ var Bindings = binding.New(
 type Tank struct {
 	*assets.Tank
 	Pos, Vel, Aim                 mat.Vec
-	BaseRot, TurretRot            float64
-	Reloader                      timer.Timer
+	BaseRot                       float64
+	Guns                          []Gun
 	Health                        int
 	Name                          string
-	BaseSprite, TurretSprite      ggl.Sprite
+	BaseSprite                    ggl.Sprite
 	Input                         binding.S
 	Player                        bool
+	Client                        int
 	Address                       mat.Point
 	Group, ID, Target, Score      int
 	Healing                       timer.Timer
 	Mask                          mat.RGBA
 	HitInter, HealInter, BarInter Interpolator
+	Path                          Path
+}
+
+// Init sets tank to fresh state of given type
+func (t *Tank) Init(tank *assets.Tank) {
+	t.Tank = tank
+	t.Health = tank.MaxHealth
+	t.Input = Bindings.Clone()
+	t.BaseSprite = tank.BaseSprite
+	t.InitGuns(0)
+	t.Target = -1
+	t.Path.Reset()
+	t.Healing = timer.Period(tank.RegenerationProc)
+	t.Mask = rgba.White
+
+	t.HealInter.End = 1
+	t.HitInter.End = 1
+	t.BarInter.Start = .8
+	t.HitInter.Timer = timer.Period(.2)
+	t.HealInter.Timer = timer.Period(tank.RegenerationTick)
+	t.BarInter.Timer = timer.Period(2)
 }
 
 func (t *Tank) Hit(b *Bullet) {
-	t.Health -= b.Damage
-	t.Target = b.Owner
+	t.Damage(b.Damage, b.Owner)
+}
+
+// Damage takes health of tank, by is id of tank that dealt the damage
+func (t *Tank) Damage(damage, by int) {
+	t.Health -= damage
+	t.Target = by
 	t.Healing.Progress = 0
 	t.Healing.Period = t.RegenerationProc
 
@@ -587,6 +858,20 @@ func (t *Tank) Hit(b *Bullet) {
 	t.BarInter.Reset()
 }
 
+// Animate updates hit and heal color effects
+func (t *Tank) Animate(delta float64) {
+	if !t.HealInter.Done() {
+		col := t.HealInter.Update(delta)
+		t.Mask.R = col
+		t.Mask.B = col
+	}
+	if !t.HitInter.Done() {
+		col := t.HitInter.Update(delta)
+		t.Mask.G = col
+		t.Mask.B = col
+	}
+}
+
 func (t *Tank) Heal(delta float64) {
 	if t.Healthy() {
 		return
@@ -603,6 +888,14 @@ func (t *Tank) Heal(delta float64) {
 	}
 }
 
+// Describe returns tank type name, marked if tank is controlled by player
+func (t *Tank) Describe() string {
+	if t.Player {
+		return t.Tank.Name + "(player)"
+	}
+	return t.Tank.Name
+}
+
 func (t *Tank) Dead() bool {
 	return t.Health <= 0
 }
@@ -630,6 +923,11 @@ type Bullet struct {
 	Live             timer.Timer
 	Sprite           ggl.Sprite
 	Group, ID, Owner int
+	// Rewind is how many ticks behind the shooter saw other tanks, server
+	// checks hits against their past positions
+	Rewind int
+	// Speed of bullet can differ from Speed of asset by SpeedVariance
+	Speed float64
 }
 
 type State uint8
@@ -639,6 +937,8 @@ const (
 	Singleplayer
 	MultiplayerServer
 	MultiplayerClient
+	Replaying
+	InLobby
 )
 
 type Interpolator struct {
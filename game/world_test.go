@@ -0,0 +1,95 @@
+package game
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/jakubDoka/tanks/game/assets"
+)
+
+var (
+	testAssetsOnce sync.Once
+	testAssets     *assets.Assets
+)
+
+// loadAssets loads embedded assets once for all tests
+func loadAssets(t testing.TB) *assets.Assets {
+	testAssetsOnce.Do(func() {
+		testAssets = assets.NAssets()
+		testAssets.Load("assets", assets.RawAssets)
+		testAssets.Compile()
+		for _, e := range testAssets.Errors {
+			t.Log(e)
+		}
+	})
+	return testAssets
+}
+
+// testWorld creates headless singleplayer world of given map and seed
+func testWorld(t testing.TB, name string, seed int64) *World {
+	a := loadAssets(t)
+	world, _, ok := a.Worlds.World(name)
+	if !ok {
+		t.Fatalf("world %q is missing", name)
+	}
+
+	w := NHeadlessWorld(a)
+	w.LoadMapSeed(Singleplayer, world, seed)
+	return w
+}
+
+// emptyWorld is testWorld without any tanks, storage is new so it has no
+// spare capacity
+func emptyWorld(t testing.TB) *World {
+	w := testWorld(t, "medium", 1)
+	for _, id := range w.Tanks.Occupied() {
+		tk := w.Tanks.Item(id)
+		w.Hasher.Remove(tk.Address, tk.ID, tk.Group)
+	}
+	w.Tanks = TankStorage{}
+	w.Player = -1
+	w.Delta = w.Step
+	return w
+}
+
+// sameState fails the test if simulation state of worlds differs
+func sameState(t testing.TB, a, b *World) {
+	t.Helper()
+	if a.Ticks != b.Ticks {
+		t.Fatalf("ticks differ: %d != %d", a.Ticks, b.Ticks)
+	}
+	if !reflect.DeepEqual(a.Capture(), b.Capture()) {
+		t.Fatalf("state differs at tick %d", a.Ticks)
+	}
+}
+
+func TestHeadlessSimulate(t *testing.T) {
+	a := loadAssets(t)
+	tanks, bullets := 0, 0
+	for _, wd := range a.Worlds.Slice() {
+		// no window, batch or ui scenes exist, touching them would panic
+		w := testWorld(t, wd.K, 1)
+		if w.Player == -1 {
+			t.Fatalf("%s: player tank was not spawned", wd.K)
+		}
+
+		for i := 0; i < 1200; i++ {
+			w.Simulate(w.Step)
+			if c := w.Tanks.Count(); c > tanks {
+				tanks = c
+			}
+			if c := w.Bullets.Count(); c > bullets {
+				bullets = c
+			}
+		}
+
+		if w.Ticks != 1200 {
+			t.Fatalf("%s: simulated %d ticks", wd.K, w.Ticks)
+		}
+	}
+
+	if tanks < 2 || bullets == 0 {
+		t.Fatalf("matches did not play out, %d tanks and %d bullets at most", tanks, bullets)
+	}
+}
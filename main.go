@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/jakubDoka/mlok/logic/frame"
 	"github.com/jakubDoka/tanks/game"
 )
@@ -11,6 +14,15 @@ type Student struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "server" {
+		err := game.RunServer(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	game := game.NGame()
 
 	ticker := frame.Delta{}